@@ -103,15 +103,52 @@ class Chess extends Window {
     }
 
     InitWasmChessAi() {
-        const go = new Go();
-        WebAssembly.instantiateStreaming(fetch("chess/chess.wasm"), go.importObject).then((result) => {
+        if (!Chess.wasm) { //one module for all windows, each window gets an engine of its own
+            const go = new Go();
+            Chess.wasm = WebAssembly.instantiateStreaming(fetch("chess/chess.wasm"), go.importObject).then((result) => {
+                go.run(result.instance);
+            });
+        }
+
+        Chess.wasm.then(() => {
+            this.engine = ChessNewEngine();
+
             if (this.args) {
                 this.LoadFen(this.args);
             } else {
                 this.LoadFen(Chess.FEN_START);
             }
+        });
+    }
+
+    Close() { //override
+        if (this.engine) {
+            this.engine.dispose();
+            this.engine = null;
+        }
+
+        super.Close();
+    }
+
+    PlayAiMove(fen) {
+        if (!this.engine) return;
+
+        //the engine follows the game move by move, unless a position was loaded
+        const fields = fen => fen.split(" ").slice(0, 3).join(" ");
+        if (fields(this.engine.fen()) !== fields(fen))
+            this.engine.position(fen);
+
+        this.engine.go().then(json => {
+            //{move, san, score, mate, depth, pv, nodes, time, book, status, error}
+            let result = JSON.parse(json);
+            if (result.error) throw (`ai: ${result.error}`);
+            if (!result.move) return; //no legal move, the game is over
+            if (!this.engine) return; //closed while thinking
 
-            go.run(result.instance);
+            let aiP0 = {x: result.move.charCodeAt(0) - 97, y: 8 - parseInt(result.move[1])};
+            let aiP1 = {x: result.move.charCodeAt(2) - 97, y: 8 - parseInt(result.move[3])};
+
+            this.PlayMove(aiP0, aiP1, null);
         });
     }
 
@@ -211,6 +248,8 @@ class Chess extends Window {
         this.game.activecolor = array[1];
         this.game.castling = array[2];
         this.game.enpassant = array[3];
+        this.game.halfmove = parseInt(array[4]) || 0;
+        this.game.fullmove = parseInt(array[5]) || 1;
         this.game.lastmove = array[6];
 
         for (let y = 0; y < 8; y++)
@@ -260,7 +299,6 @@ class Chess extends Window {
         notaion += " " + this.game.enpassant;
         notaion += " " + this.game.halfmove;
         notaion += " " + this.game.fullmove;
-        notaion += " " + this.game.lastmove;
         return notaion;
     }
     
@@ -299,13 +337,20 @@ class Chess extends Window {
 
         let isCapture = false;
 
+        //what the move does as the engine sees it: capture, check, castle, ...
+        let flags = null;
+        if (this.engine) {
+            flags = JSON.parse(this.engine.move(`${String.fromCharCode(97+p0.x)}${8-p0.y}${String.fromCharCode(97+p1.x)}${8-p1.y}`));
+            if (flags.error) flags = null; //out of sync, resynchronized before the engine moves
+        }
+
         const pieces = Array.from(this.board.querySelectorAll(".chess-piece"));
         
         if (!element)
             element = pieces.find(piece => piece.getAttribute("p")[0] == p0.x && piece.getAttribute("p")[1] == p0.y);
 
-        if (this.game.placement[p0.x][p0.y].toLowerCase() === "p" && Math.abs(p0.y - p1.y) === 2) { //en passant flag
-            this.game.enpassant = String.fromCharCode(97 + p1.x) + (8 - p1.y);
+        if (this.game.placement[p0.x][p0.y].toLowerCase() === "p" && Math.abs(p0.y - p1.y) === 2) { //en passant flag, the square behind the pawn
+            this.game.enpassant = String.fromCharCode(97 + p1.x) + (8 - (p0.y + p1.y) / 2);
         } else {
             this.game.enpassant = "-";
         }
@@ -369,13 +414,22 @@ class Chess extends Window {
             const captured = pieces.find(ele => ele !== element && ele.style.left === p1.x * 12.5 + "%" && ele.style.top === p1.y * 12.5 + "%");
             if (captured) this.board.removeChild(captured);
             isCapture = true;
+        }
+
+        if (flags && flags.check)
+            this.sounds.check.play();
+        else if (isCapture)
             this.sounds.capture.play();
-        } else {
+        else
             this.sounds.move.play();
-        }
 
         this.game.placement[p1.x][p1.y] = this.game.placement[p0.x][p0.y];
         this.game.placement[p0.x][p0.y] = null;
+
+        if (isCapture || this.game.placement[p1.x][p1.y].toLowerCase() === "p") //fifty move rule
+            this.game.halfmove = 0;
+        else
+            this.game.halfmove++;
         
         element.style.left = p1.x * 12.5 + "%";
         element.style.top = p1.y * 12.5 + "%";
@@ -399,20 +453,14 @@ class Chess extends Window {
             } else {
                 const callback = ()=>{
                     setTimeout(()=>{
-                        let aiMove = ChessAi(this.GetCurrentFen(), 1);
-                        if (!aiMove) throw ("ai panic");
-                        if (aiMove.length < 5) return;
-        
-                        let aiP0 = {x: aiMove.charCodeAt(0) - 97, y: 8 - parseInt(aiMove[1])};
-                        let aiP1 = {x: aiMove.charCodeAt(3) - 97, y: 8 - parseInt(aiMove[4])};
-                        
-                        this.PlayMove(aiP0, aiP1, null);
+                        this.PlayAiMove(this.GetCurrentFen());
                     });
                 };
                 this.PromoteDialog(p1, element, callback);
             }
         }
         
+        if (this.game.activecolor === "b") this.game.fullmove++;
         this.game.activecolor = this.game.activecolor === "w" ? "b" : "w";
 
         this.AddChessNotation(p0, p1, isCapture);
@@ -429,7 +477,7 @@ class Chess extends Window {
         this.game.lastmove = `${String.fromCharCode(97+p0.x)}${8-p0.y}${String.fromCharCode(97+p1.x)}${8-p1.y}`;
 
         let fen = this.GetCurrentFen();
-        this.args = fen;
+        this.args = fen + " " + this.game.lastmove; //the last move is marked when the window is restored
 
 
         if (this.game.activecolor === "w" && this.playerA === "ai" ||
@@ -439,14 +487,7 @@ class Chess extends Window {
                 !(this.game.placement[p1.x][p1.y] === "p" && p1.y === 7)) { //not a promote
                 
                 setTimeout(()=>{
-                    let aiMove = ChessAi(fen, 1);
-                    if (!aiMove) throw ("ai panic");
-                    if (aiMove.length < 5) return;
-
-                    let aiP0 = {x: aiMove.charCodeAt(0) - 97, y: 8 - parseInt(aiMove[1])};
-                    let aiP1 = {x: aiMove.charCodeAt(3) - 97, y: 8 - parseInt(aiMove[4])};
-
-                    this.PlayMove(aiP0, aiP1, null);
+                    this.PlayAiMove(fen);
                 }, 500);
             }
         }
@@ -480,7 +521,12 @@ class Chess extends Window {
 
         const updateMoveList = (l)=>{
             //TODO:
-            this.args = this.GetCurrentFen();
+            this.args = this.GetCurrentFen() + " " + this.game.lastmove;
+
+            if (this.engine) { //the engine promoted to a queen
+                this.engine.undo();
+                this.engine.move(this.game.lastmove + l.toLowerCase());
+            }
         };
 
         q.onclick = ()=>{
@@ -575,8 +621,8 @@ class Chess extends Window {
                 if (game.enpassant !== "-") { //enpassant
                     let x = game.enpassant.charCodeAt(0) - 97;
                     let y = 8 - parseInt(game.enpassant[1]);
-                    if (y === p.y && Math.abs(x - p.x) === 1)
-                        moves.push({ x: x, y: y - 1 });
+                    if (y === p.y - 1 && Math.abs(x - p.x) === 1)
+                        moves.push({ x: x, y: y });
                 }
 
             } else {
@@ -601,8 +647,8 @@ class Chess extends Window {
                 if (game.enpassant !== "-") { //enpassant
                     let x = game.enpassant.charCodeAt(0) - 97;
                     let y = 8 - parseInt(game.enpassant[1]);
-                    if (y === p.y && Math.abs(x - p.x) === 1)
-                        moves.push({ x: x, y: y + 1 });
+                    if (y === p.y + 1 && Math.abs(x - p.x) === 1)
+                        moves.push({ x: x, y: y });
                 }
                 
             }
@@ -762,6 +808,20 @@ class Chess extends Window {
     }
 
     GetLegalMoves(p, game) {
+        if (typeof ChessLegalMoves === "function") { //the rules of the engine, once it is loaded
+            const square = String.fromCharCode(97 + p.x) + (8 - p.y);
+            const moves = JSON.parse(ChessLegalMoves(this.GetCurrentFen(), square));
+            if (!moves.error) {
+                let legal = [];
+                for (let i = 0; i < moves.length; i++) {
+                    let target = { x: moves[i].to.charCodeAt(0) - 97, y: 8 - parseInt(moves[i].to[1]) };
+                    if (!legal.find(move => move.x === target.x && move.y === target.y)) //one per promotion piece
+                        legal.push(target);
+                }
+                return legal;
+            }
+        }
+
         const piece = game.placement[p.x][p.y];
         const color = this.GetPieceColor(p, game);
         const enemyColor = game.activecolor === "w" ? "b" : "w";
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Summaries of an annotated game for each player: the average centipawn
+// loss, an accuracy percentage from the win probability every move gives
+// away, how many moves fell into each class, and the same per phase of
+// the game.
+
+const (
+	openingMoves  = 12 //moves that count as the opening, unless the endgame comes first
+	endgamePhase  = 8  //evaluation phase from which on a position is an endgame
+	winProbSlope  = 0.00368208
+	accuracyScale = 103.1668
+	accuracyDecay = 0.04354
+	accuracyShift = 3.1669
+)
+
+// accuracyReport is the part of a gameAnalysis worth keeping to follow the
+// players over many games.
+type accuracyReport struct {
+	Tags   map[string]string `json:"tags"`
+	Start  string            `json:"start"`
+	Result string            `json:"result"`
+	White  playerReport      `json:"white"`
+	Black  playerReport      `json:"black"`
+}
+
+type phaseReport struct {
+	Moves    int     `json:"moves"`
+	Acpl     int     `json:"acpl"`     //average centipawn loss
+	Accuracy float64 `json:"accuracy"` //average move accuracy, 0 to 100
+}
+
+type playerReport struct {
+	phaseReport
+	Classes map[string]int         `json:"classes"` //moves per class, every class included
+	Phases  map[string]phaseReport `json:"phases"`  //opening, middlegame and endgame
+}
+
+// winProbability is the chance to win in percent, draws counting half, of
+// the side a score is for.
+func winProbability(score int) float64 {
+	return 50 + 50*(2/(1+math.Exp(-winProbSlope*float64(score)))-1)
+}
+
+// moveAccuracy is 100 for a move that keeps the winning chances of the
+// position, falling steeply with the win probability it gives away.
+// Scores are from the mover's point of view, the accuracy is rounded to a
+// tenth.
+func moveAccuracy(before, after int) float64 {
+	var lost float64 = max(winProbability(before)-winProbability(after), 0)
+	var accuracy float64 = min(max(accuracyScale*math.Exp(-accuracyDecay*lost)-accuracyShift, 0), 100)
+	return math.Round(accuracy*10) / 10
+}
+
+func gamePhase(game *Game) string {
+	if traceEvaluation(game).Phase <= endgamePhase {
+		return "endgame"
+	}
+	if fullMove, _ := strconv.Atoi(game.fullMove); fullMove <= openingMoves {
+		return "opening"
+	}
+	return "middlegame"
+}
+
+// newPlayerReport summarizes the moves of one player, those at even
+// indexes of plies if first is true, otherwise those at odd ones.
+func newPlayerReport(plies []plyAnalysis, first bool) playerReport {
+	var report playerReport = playerReport{
+		Classes: map[string]int{"best": 0, "good": 0, "inaccuracy": 0, "mistake": 0, "blunder": 0},
+		Phases:  map[string]phaseReport{},
+	}
+
+	var total [2]float64 //loss and accuracy of the whole game
+	var phases map[string]*[3]float64 = map[string]*[3]float64{"opening": {}, "middlegame": {}, "endgame": {}}
+
+	for i := 0; i < len(plies); i++ {
+		if (i%2 == 0) != first {
+			continue
+		}
+		var ply plyAnalysis = plies[i]
+
+		report.Moves++
+		report.Classes[ply.Class]++
+		total[0] += float64(ply.Loss)
+		total[1] += ply.Accuracy
+		phases[ply.Phase][0]++
+		phases[ply.Phase][1] += float64(ply.Loss)
+		phases[ply.Phase][2] += ply.Accuracy
+	}
+
+	report.phaseReport = averages(float64(report.Moves), total[0], total[1])
+	for name, sums := range phases {
+		report.Phases[name] = averages(sums[0], sums[1], sums[2])
+	}
+	return report
+}
+
+// averages makes a phaseReport from the sums over moves.
+func averages(moves, loss, accuracy float64) phaseReport {
+	if moves == 0 {
+		return phaseReport{}
+	}
+	return phaseReport{
+		Moves:    int(moves),
+		Acpl:     int(math.Round(loss / moves)),
+		Accuracy: math.Round(accuracy/moves*10) / 10,
+	}
+}
+
+// accuracyJson annotates a game as annotateGame and returns the report of
+// both players as JSON.
+func accuracyJson(text string, budget annotateBudget, progress func(done, total int), yield func()) (string, error) {
+	analysis, err := annotateGame(text, budget, progress, yield)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(newAccuracyReport(analysis))
+	return string(data), err
+}
+
+func newAccuracyReport(analysis gameAnalysis) accuracyReport {
+	return accuracyReport{Tags: analysis.Tags, Start: analysis.Start, Result: analysis.Result, White: analysis.White, Black: analysis.Black}
+}
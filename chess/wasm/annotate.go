@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Post-game analysis: every position of a game is searched with the same
+// budget, every move is graded by the centipawns it loses against the best
+// move, and the game is written back as PGN with NAGs, comments and the
+// better line as a variation.
+
+// Centipawn losses from which a move is graded worse than good.
+const (
+	inaccuracyLoss = 50
+	mistakeLoss    = 100
+	blunderLoss    = 300
+)
+
+const (
+	lossCap        = 1000  //losses are counted between scores capped to this
+	mateEval       = 10000 //the evaluation of a forced mate in the eval series
+	variationPlies = 8     //moves of the better line given as a variation
+)
+
+type annotateBudget struct {
+	nodes int //per position
+	depth int
+}
+
+var defaultAnnotateBudget annotateBudget = annotateBudget{nodes: 10000, depth: maxSearchDepth}
+
+type plyAnalysis struct {
+	Ply      int      `json:"ply"` //1 for the first move of the game
+	Move     string   `json:"move"`
+	San      string   `json:"san"`
+	Eval     int      `json:"eval"`           //after the move, white's point of view, centipawns
+	Mate     *int     `json:"mate,omitempty"` //moves to mate after the move, negative when black mates, 0 when the move mates
+	Best     string   `json:"best"`           //SAN of the engine's move in the position before
+	BestEval int      `json:"bestEval"`       //the evaluation after it, as for eval
+	Loss     int      `json:"loss"`           //centipawns lost against the best move, from the mover's point of view
+	Class    string   `json:"class"`          //"best", "good", "inaccuracy", "mistake" or "blunder"
+	Nag      string   `json:"nag,omitempty"`  //"?!", "?" or "??"
+	Line     []string `json:"line"`           //the engine's line instead of the move, in SAN
+	Accuracy float64  `json:"accuracy"`       //0 to 100, from the win probability lost
+	Phase    string   `json:"phase"`          //"opening", "middlegame" or "endgame"
+}
+
+type gameAnalysis struct {
+	Tags   map[string]string `json:"tags"` //of the PGN
+	Start  string            `json:"start"`
+	Result string            `json:"result"`
+	Plies  []plyAnalysis     `json:"plies"`
+	Evals  []int             `json:"evals"` //white's point of view for the start and after every ply, for an eval graph
+	Pgn    string            `json:"pgn"`   //the annotated game
+	White  playerReport      `json:"white"`
+	Black  playerReport      `json:"black"`
+}
+
+// graphScore converts a search score to an evaluation for the eval series,
+// mates counting as mateEval.
+func graphScore(score int) int {
+	if score > mateBound {
+		return mateEval
+	}
+	if score < -mateBound {
+		return -mateEval
+	}
+	return score
+}
+
+func capLoss(score int) int {
+	return min(max(score, -lossCap), lossCap)
+}
+
+func classifyLoss(loss int) (string, string) {
+	switch {
+	case loss >= blunderLoss:
+		return "blunder", "??"
+	case loss >= mistakeLoss:
+		return "mistake", "?"
+	case loss >= inaccuracyLoss:
+		return "inaccuracy", "?!"
+	}
+	return "good", ""
+}
+
+// analyzeGamePosition searches the current position of a game within the
+// budget and returns the best line, with a score from the side to move's
+// point of view. The line is empty when the game is over.
+func analyzeGamePosition(g *GameSession, table *transpositionTable, budget annotateBudget, yield func()) searchLine {
+	var game *Game = g.current()
+	if len(legalMoves(game, game.color)) == 0 {
+		if inCheck(*game, game.color) {
+			return searchLine{Score: -mateScore}
+		}
+		return searchLine{}
+	}
+
+	var s search = search{nodeLimit: budget.nodes, table: table, history: g.history(), yield: yield, quiesce: true}
+	var lines []searchLine = s.iterate(game, budget.depth, 1, nil)
+	return lines[0]
+}
+
+// annotateGame analyzes every move of the first game of a PGN, or of a list
+// of moves in SAN or coordinate notation. progress, if not nil, is called
+// after every position searched.
+func annotateGame(text string, budget annotateBudget, progress func(done, total int), yield func()) (gameAnalysis, error) {
+	var pgn *pgnGame
+	err := readPgn(strings.NewReader(text), func(game *pgnGame) error {
+		if pgn == nil {
+			pgn = game
+		}
+		return nil
+	})
+	if err != nil {
+		return gameAnalysis{}, err
+	}
+	if pgn == nil {
+		return gameAnalysis{}, errors.New("no game to annotate")
+	}
+
+	return annotatePgn(pgn, budget, progress, yield)
+}
+
+// annotatePgn is annotateGame for a game read from a PGN.
+func annotatePgn(pgn *pgnGame, budget annotateBudget, progress func(done, total int), yield func()) (gameAnalysis, error) {
+	start, err := pgn.start()
+	if err != nil {
+		return gameAnalysis{}, err
+	}
+
+	var g *GameSession = newGameSession(start)
+	for _, text := range pgn.moves {
+		move, err := parseMove(g.current(), text)
+		if err != nil {
+			return gameAnalysis{}, err
+		}
+		g.play(move)
+	}
+
+	//every position from the start, searched with a table shared by all
+	var table *transpositionTable = newTranspositionTable(defaultHashSize)
+	var lines []searchLine
+	var replay *GameSession = newGameSession(start)
+	for i := 0; i <= len(g.moves); i++ {
+		lines = append(lines, analyzeGamePosition(replay, table, budget, yield))
+		if i < len(g.moves) {
+			replay.play(g.moves[i])
+		}
+		if progress != nil {
+			progress(i+1, len(g.moves)+1)
+		}
+	}
+
+	var result gameAnalysis = gameAnalysis{Tags: pgn.tags, Start: toFen(&start), Result: pgn.result, Plies: []plyAnalysis{}, Evals: []int{}}
+	for i, line := range lines {
+		var white int = graphScore(line.Score)
+		if g.positions[i].color == Black {
+			white = -white
+		}
+		result.Evals = append(result.Evals, white)
+	}
+
+	for i, move := range g.moves {
+		var game *Game = &g.positions[i]
+		var best searchLine = lines[i]
+		var played int = -lines[i+1].Score //the mover's point of view
+
+		var ply plyAnalysis = plyAnalysis{
+			Ply:      i + 1,
+			Move:     moveToUci(move),
+			San:      moveToSan(game, move),
+			Eval:     result.Evals[i+1],
+			Best:     best.San,
+			BestEval: graphScore(best.Score),
+			Line:     []string{},
+			Phase:    gamePhase(game),
+		}
+		if game.color == Black {
+			ply.BestEval = -ply.BestEval
+		}
+		if mate := -mateIn(lines[i+1].Score); mate != 0 || gameStatus(&g.positions[i+1]) == "checkmate" {
+			if game.color == Black {
+				mate = -mate
+			}
+			ply.Mate = &mate
+		}
+
+		if best.move == move {
+			ply.Class = "best"
+			ply.Accuracy = 100
+		} else {
+			ply.Accuracy = moveAccuracy(graphScore(best.Score), graphScore(played))
+			ply.Loss = max(capLoss(best.Score)-capLoss(played), 0)
+			ply.Class, ply.Nag = classifyLoss(ply.Loss)
+			if ply.Nag != "" {
+				ply.Line = best.PvSan[:min(len(best.PvSan), variationPlies)]
+			}
+		}
+
+		result.Plies = append(result.Plies, ply)
+	}
+
+	result.White = newPlayerReport(result.Plies, start.color == White)
+	result.Black = newPlayerReport(result.Plies, start.color == Black)
+	result.Pgn = writeAnnotatedPgn(pgn, &start, result)
+	return result, nil
+}
+
+// annotateJson is annotateGame as JSON.
+func annotateJson(text string, budget annotateBudget, progress func(done, total int), yield func()) (string, error) {
+	analysis, err := annotateGame(text, budget, progress, yield)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(analysis)
+	return string(data), err
+}
+
+// the tags of the Seven Tag Roster and of the start position, which come
+// first and in this order
+var rosterTags []string = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result", "SetUp", "FEN"}
+
+// pgnEscaper escapes a tag value, PGN only knows \\ and \".
+var pgnEscaper *strings.Replacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeAnnotatedPgn writes the game with the NAGs, a comment and the better
+// line of every inaccuracy, mistake and blunder.
+func writeAnnotatedPgn(pgn *pgnGame, start *Game, analysis gameAnalysis) string {
+	var builder strings.Builder
+
+	//export format requires the whole roster, unknown values are "?"
+	var tags map[string]string = map[string]string{"Event": "?", "Site": "?", "Date": "????.??.??", "Round": "?", "White": "?", "Black": "?"}
+	for name, value := range pgn.tags {
+		tags[name] = value
+	}
+	tags["Result"] = analysis.Result
+	if analysis.Start != initialFen {
+		tags["SetUp"] = "1"
+		tags["FEN"] = analysis.Start
+	}
+
+	var names []string
+	for name := range tags {
+		if indexOf(rosterTags, name) == -1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range append(append([]string{}, rosterTags...), names...) {
+		if value, ok := tags[name]; ok {
+			builder.WriteString("[" + name + " \"" + pgnEscaper.Replace(value) + "\"]\n")
+		}
+	}
+	builder.WriteString("\n")
+
+	var tokens []string
+	var number, _ = strconv.Atoi(start.fullMove)
+	var color PieceColor = start.color
+	var interrupted bool = true //the next black move needs its number
+
+	for _, ply := range analysis.Plies {
+		if color == White {
+			tokens = append(tokens, strconv.Itoa(number)+".")
+		} else if interrupted {
+			tokens = append(tokens, strconv.Itoa(number)+"...")
+		}
+		tokens = append(tokens, ply.San+ply.Nag)
+		interrupted = false
+
+		if ply.Nag != "" {
+			var comment string = strings.ToUpper(ply.Class[:1]) + ply.Class[1:] + ". " + ply.Best + " was best."
+			tokens = append(tokens, "{ "+comment+" }")
+
+			var variation []string = []string{"(" + moveNumber(number, color)}
+			for j, san := range ply.Line {
+				var side PieceColor = color
+				var n int = number
+				if j%2 == 1 {
+					side = flipColor(color)
+				}
+				if j > 0 && side == White {
+					n += (j + 1) / 2
+					variation = append(variation, strconv.Itoa(n)+".")
+				}
+				variation = append(variation, san)
+			}
+			variation[len(variation)-1] += ")"
+			tokens = append(tokens, variation...)
+			interrupted = true
+		}
+
+		if color == Black {
+			number++
+		}
+		color = flipColor(color)
+	}
+	tokens = append(tokens, analysis.Result)
+
+	//lines of at most 80 characters
+	var length int = 0
+	for i, token := range tokens {
+		if i > 0 && length+1+len(token) > 79 {
+			builder.WriteString("\n")
+			length = 0
+		} else if i > 0 {
+			builder.WriteString(" ")
+			length++
+		}
+		builder.WriteString(token)
+		length += len(token)
+	}
+	builder.WriteString("\n")
+
+	return builder.String()
+}
+
+// moveNumber is "12." before a white move and "12..." before a black one.
+func moveNumber(number int, color PieceColor) string {
+	if color == White {
+		return strconv.Itoa(number) + "."
+	}
+	return strconv.Itoa(number) + "..."
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
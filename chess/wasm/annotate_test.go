@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotatedPgnTags(t *testing.T) {
+	var budget annotateBudget = annotateBudget{nodes: 2000, depth: maxSearchDepth}
+
+	analysis, err := annotateGame("e2e4 e7e5", budget, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roster string = "[Event \"?\"]\n[Site \"?\"]\n[Date \"????.??.??\"]\n[Round \"?\"]\n[White \"?\"]\n[Black \"?\"]\n[Result \"*\"]\n\n"
+	if !strings.HasPrefix(analysis.Pgn, roster) {
+		t.Errorf("move list: tags of\n%s", analysis.Pgn)
+	}
+
+	analysis, err = annotateGame("[Event \"a \\\\ \\\"b\\\"\"]\n\n1. e4 *", budget, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(analysis.Pgn, "[Event \"a \\\\ \\\"b\\\"\"]\n[Site \"?\"]\n") {
+		t.Errorf("escaped event: tags of\n%s", analysis.Pgn)
+	}
+}
+
+func TestAnnotateMate(t *testing.T) {
+	analysis, err := annotateGame("e4 e5 Qh5 Nc6 Bc4 Nf6 Qxf7#", annotateBudget{nodes: 2000, depth: maxSearchDepth}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last plyAnalysis = analysis.Plies[len(analysis.Plies)-1]
+	if last.Mate == nil || *last.Mate != 0 {
+		t.Errorf("Qxf7#: mate %v, want 0", last.Mate)
+	}
+	if analysis.Plies[5].Class != "blunder" {
+		t.Errorf("Nf6: %s, want blunder", analysis.Plies[5].Class)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+// Polyglot opening books. A .bin book is a list of 16 byte entries sorted
+// by position key, all big endian:
+//
+//	key    uint64  polyglotKey of the position
+//	move   uint16  to file, to row, from file, from row (3 bits each, from
+//	               the lowest bits), promotion (0 none, 1 knight ... 4 queen)
+//	weight uint16  how good or frequent the move is
+//	learn  uint32  unused
+//
+// Castling is stored as the king taking its own rook, e.g. e1h1.
+
+const bookEntrySize = 16
+
+type bookEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+	learn  uint32
+}
+
+type openingBook struct {
+	entries []bookEntry
+}
+
+var book *openingBook         //nil without a book
+var bookEnabled bool = true   //consult the book before searching
+var bookBestMove bool = false //always play the highest weighted move instead of a weighted random one
+
+func parseBook(data []byte) (*openingBook, error) {
+	if len(data)%bookEntrySize != 0 {
+		return nil, errors.New("not a polyglot book")
+	}
+
+	var b *openingBook = &openingBook{entries: make([]bookEntry, len(data)/bookEntrySize)}
+	for i := range b.entries {
+		var entry []byte = data[i*bookEntrySize:]
+		b.entries[i] = bookEntry{
+			key:    binary.BigEndian.Uint64(entry),
+			move:   binary.BigEndian.Uint16(entry[8:]),
+			weight: binary.BigEndian.Uint16(entry[10:]),
+			learn:  binary.BigEndian.Uint32(entry[12:]),
+		}
+	}
+
+	//books should be sorted already, but a lookup must not miss entries
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		return b.entries[i].key < b.entries[j].key
+	})
+
+	return b, nil
+}
+
+// lookup returns the entries of a position.
+func (b *openingBook) lookup(key uint64) []bookEntry {
+	var first int = sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].key >= key
+	})
+
+	var last int = first
+	for last < len(b.entries) && b.entries[last].key == key {
+		last++
+	}
+
+	return b.entries[first:last]
+}
+
+// bookMoves returns the legal book moves of a position with their weights.
+func (b *openingBook) bookMoves(game *Game) ([]Move, []int) {
+	var moves []Move
+	var weights []int
+
+	for _, entry := range b.lookup(polyglotKey(game)) {
+		move, ok := decodeBookMove(game, entry.move)
+		if !ok {
+			continue
+		}
+		moves = append(moves, move)
+		weights = append(weights, int(entry.weight))
+	}
+
+	return moves, weights
+}
+
+// bookMove picks a move from the loaded book, if it has one for the position.
+func bookMove(game *Game) (Move, bool) {
+	if !bookEnabled {
+		return Move{}, false
+	}
+	return chooseBookMove(game, bookBestMove)
+}
+
+// chooseBookMove picks a weighted random book move, or with best the
+// highest weighted one.
+func chooseBookMove(game *Game, best bool) (Move, bool) {
+	if book == nil {
+		return Move{}, false
+	}
+
+	moves, weights := book.bookMoves(game)
+	if len(moves) == 0 {
+		return Move{}, false
+	}
+
+	var total int = 0
+	var top int = 0
+	for i, weight := range weights {
+		total += weight
+		if weight > weights[top] {
+			top = i
+		}
+	}
+
+	if best || total == 0 {
+		return moves[top], true
+	}
+
+	var r int = rand.Intn(total)
+	for i, weight := range weights {
+		if r < weight {
+			return moves[i], true
+		}
+		r -= weight
+	}
+
+	return moves[top], true
+}
+
+// decodeBookMove converts a book move to a legal move of the position.
+// Moves that are not legal, e.g. after a key collision, are rejected.
+func decodeBookMove(game *Game, move uint16) (Move, bool) {
+	var result Move = Move{
+		p0: Position{x: int(move>>6) & 7, y: 7 - (int(move>>9) & 7)},
+		p1: Position{x: int(move) & 7, y: 7 - (int(move>>3) & 7)},
+	}
+
+	switch (move >> 12) & 7 {
+	case 1:
+		result.promotion = Knight
+	case 2:
+		result.promotion = Bishop
+	case 3:
+		result.promotion = Rook
+	case 4:
+		result.promotion = Queen
+	}
+
+	//the king takes its own rook when castling
+	var piece Piece = game.placement[result.p0.x][result.p0.y]
+	var target Piece = game.placement[result.p1.x][result.p1.y]
+	if piece.piece == King && target.piece == Rook && target.color == piece.color {
+		if result.p1.x == 7 {
+			result.p1.x = 6
+		} else if result.p1.x == 0 {
+			result.p1.x = 2
+		}
+	}
+
+	for _, legal := range legalMoves(game, game.color) {
+		if legal == result {
+			return legal, true
+		}
+	}
+
+	return Move{}, false
+}
+
+// encodeBookMove is the reverse of decodeBookMove.
+func encodeBookMove(game *Game, move Move) uint16 {
+	var to Position = move.p1
+	if isCastling(game, move) { //the king takes its own rook
+		if to.x == 6 {
+			to.x = 7
+		} else {
+			to.x = 0
+		}
+	}
+
+	var promotion uint16 = 0
+	switch move.promotion {
+	case Knight:
+		promotion = 1
+	case Bishop:
+		promotion = 2
+	case Rook:
+		promotion = 3
+	case Queen:
+		promotion = 4
+	}
+
+	return uint16(to.x) | uint16(7-to.y)<<3 | uint16(move.p0.x)<<6 | uint16(7-move.p0.y)<<9 | promotion<<12
+}
+
+// encodeBook writes the entries in the .bin format, sorted by key and then
+// by weight, best first.
+func encodeBook(entries []bookEntry) []byte {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return entries[i].weight > entries[j].weight
+	})
+
+	var data []byte = make([]byte, len(entries)*bookEntrySize)
+	for i, entry := range entries {
+		var out []byte = data[i*bookEntrySize:]
+		binary.BigEndian.PutUint64(out, entry.key)
+		binary.BigEndian.PutUint16(out[8:], entry.move)
+		binary.BigEndian.PutUint16(out[10:], entry.weight)
+		binary.BigEndian.PutUint32(out[12:], entry.learn)
+	}
+
+	return data
+}
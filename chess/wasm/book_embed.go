@@ -0,0 +1,22 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+)
+
+// The default book of the WASM build. build-wasm.ps1 only compiles this
+// file when a book.bin is present next to it.
+
+//go:embed book.bin
+var embeddedBook []byte
+
+func init() {
+	b, err := parseBook(embeddedBook)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "embedded book:", err)
+		return
+	}
+	book = b
+}
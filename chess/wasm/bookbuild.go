@@ -0,0 +1,195 @@
+//go:build !js
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Opening book construction. Every move played in the opening of a PGN
+// collection is counted with the result of its game, from the point of view
+// of the side that played it. Moves that were played often and scored well
+// enough end up in a Polyglot book, weighted by the points they scored.
+
+type bookStatsKey struct {
+	key  uint64
+	move uint16
+}
+
+type bookStats struct {
+	wins, draws, losses int
+}
+
+func (s *bookStats) games() int {
+	return s.wins + s.draws + s.losses
+}
+
+// score is the percentage of points scored with the move.
+func (s *bookStats) score() int {
+	return (200*s.wins + 100*s.draws) / (2 * s.games())
+}
+
+func makebookCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("makebook", flag.ExitOnError)
+	var in *string = flags.String("in", "", "pgn files, comma separated")
+	var out *string = flags.String("out", "book.bin", "output book")
+	var plies *int = flags.Int("plies", 30, "only count the first plies of every game")
+	var minGames *int = flags.Int("min", 3, "minimum number of games of a move")
+	var minScore *int = flags.Int("minscore", 0, "minimum score of a move in percent, for the side playing it")
+	var side *string = flags.String("side", "", "only keep the moves of white or black")
+	flags.Parse(args)
+
+	if *in == "" {
+		return errors.New("makebook: -in is required")
+	}
+	if *side != "" && *side != "white" && *side != "black" {
+		return errors.New("makebook: -side must be white or black")
+	}
+
+	var stats map[bookStatsKey]*bookStats = map[bookStatsKey]*bookStats{}
+	var games, skipped int = 0, 0
+
+	for _, path := range strings.Split(*in, ",") {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		err = readPgn(file, func(pgn *pgnGame) error {
+			games++
+			if err := countBookGame(pgn, *plies, *side, stats); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: game %d: %v\n", path, games, err)
+				skipped++
+			}
+			return nil
+		})
+		file.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	var entries []bookEntry
+	var weights []int
+	var maxWeight int = 0
+	for key, s := range stats {
+		if s.games() < *minGames || s.score() < *minScore {
+			continue
+		}
+		entries = append(entries, bookEntry{key: key.key, move: key.move})
+		weights = append(weights, 2*s.wins+s.draws)
+		maxWeight = max(maxWeight, 2*s.wins+s.draws)
+	}
+
+	for i := range entries {
+		if maxWeight > 0xffff { //large collections overflow the 16 bit weights
+			weights[i] = max(weights[i]*0xffff/maxWeight, 1)
+		}
+		entries[i].weight = uint16(weights[i])
+	}
+
+	fmt.Fprintln(os.Stderr, "games:", games, "skipped:", skipped, "moves:", len(stats), "entries:", len(entries))
+
+	return os.WriteFile(*out, encodeBook(entries), 0644)
+}
+
+// countBookGame adds the moves of a game to stats. Games without a result
+// are ignored.
+func countBookGame(pgn *pgnGame, plies int, side string, stats map[bookStatsKey]*bookStats) error {
+	var result float64
+	switch pgn.result {
+	case "1-0":
+		result = 1
+	case "0-1":
+		result = 0
+	case "1/2-1/2":
+		result = 0.5
+	default:
+		return nil
+	}
+
+	game, err := pgn.start()
+	if err != nil {
+		return err
+	}
+
+	for ply := 0; ply < len(pgn.moves) && ply < plies; ply++ {
+		move, err := parseSan(&game, pgn.moves[ply])
+		if err != nil {
+			return err
+		}
+
+		if side == "" || (side == "white") == (game.color == White) {
+			var key bookStatsKey = bookStatsKey{polyglotKey(&game), encodeBookMove(&game, move)}
+			var s *bookStats = stats[key]
+			if s == nil {
+				s = &bookStats{}
+				stats[key] = s
+			}
+
+			var score float64 = result
+			if game.color == Black {
+				score = 1 - result
+			}
+			switch score {
+			case 1:
+				s.wins++
+			case 0.5:
+				s.draws++
+			default:
+				s.losses++
+			}
+		}
+
+		game = makeMove(game, move)
+	}
+
+	return nil
+}
+
+// mergebookCommand combines books. A position is taken from the first book
+// that has it, so the books are given in order of preference.
+func mergebookCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("mergebook", flag.ExitOnError)
+	var out *string = flags.String("out", "book.bin", "output book")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		return errors.New("mergebook: at least two books are required, e.g. mergebook -out all.bin main.bin extra.bin")
+	}
+
+	var entries []bookEntry
+	var seen map[uint64]bool = map[uint64]bool{}
+
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b, err := parseBook(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		var added map[uint64]bool = map[uint64]bool{}
+		for _, entry := range b.entries {
+			if seen[entry.key] {
+				continue
+			}
+			entries = append(entries, entry)
+			added[entry.key] = true
+		}
+		for key := range added {
+			seen[key] = true
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "entries:", len(entries))
+
+	return os.WriteFile(*out, encodeBook(entries), 0644)
+}
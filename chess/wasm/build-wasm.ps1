@@ -1,3 +1,5 @@
 $Env:GOARCH ="wasm"
 $Env:GOOS = "js"
-go build -o ..\chess.wasm main.go chess.go
\ No newline at end of file
+$files = "main.go", "chess.go", "params.go", "params_default.go", "eval.go", "endgame.go", "tablebase.go", "zobrist.go", "book.go", "san.go", "pgn.go", "multipv.go", "skill.go", "search.go", "rules.go", "transposition.go", "gamesession.go", "session.go", "illegal.go", "threats.go", "tactics.go", "commentary.go", "annotate.go", "accuracy.go", "wdl.go"
+if (Test-Path book.bin) { $files += "book_embed.go" } #optional default opening book
+go build -o ..\chess.wasm $files
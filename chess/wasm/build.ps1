@@ -1,4 +1,6 @@
 $Env:GOARCH ="amd64"
 $Env:GOOS = "windows"
-go build -o chess.exe main.go chess.go
-.\chess.exe
\ No newline at end of file
+$files = "native.go", "chess.go", "params.go", "params_default.go", "eval.go", "endgame.go", "tablebase.go", "zobrist.go", "book.go", "san.go", "pgn.go", "multipv.go", "skill.go", "search.go", "rules.go", "transposition.go", "gamesession.go", "session.go", "illegal.go", "threats.go", "tactics.go", "commentary.go", "annotate.go", "accuracy.go", "wdl.go", "tuner.go", "wdlfit.go", "tbgen.go", "bookbuild.go", "uci.go", "cecp.go"
+go build -o chess.exe $files
+go test $files (Get-ChildItem -Name *_test.go)
+.\chess.exe move
\ No newline at end of file
@@ -0,0 +1,305 @@
+//go:build !js
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The Chess Engine Communication Protocol of XBoard and WinBoard, version
+// 2. As with UCI the search runs in its own goroutine; "?" makes it move
+// right away, other commands that change the game abort it first.
+
+type cecpEngine struct {
+	game  *GameSession //with the positions before every move, for undo and repetitions
+	table *transpositionTable
+	out   io.Writer
+
+	force    bool       //only record moves, do not think
+	engine   PieceColor //the side the engine plays
+	post     bool       //print thinking output
+	depth    int        //sd, 0 for no limit
+	moveTime int        //st in seconds, 0 for none
+	moves    int        //level: moves per time control, 0 for the whole game
+	base     int        //level: milliseconds per time control
+	inc      int        //level: increment in milliseconds
+	clock    int        //time: the engine's clock in milliseconds, -1 unknown
+
+	stop    atomic.Bool
+	discard atomic.Bool //the aborted search must not play its move
+	running sync.WaitGroup
+	mutex   sync.Mutex //guards game and output while a search runs
+}
+
+func xboardCommand(args []string) error {
+	return runCecp(bufio.NewScanner(os.Stdin), os.Stdout)
+}
+
+func runCecp(scanner *bufio.Scanner, out io.Writer) error {
+	var engine *cecpEngine = &cecpEngine{out: out, table: newTranspositionTable(defaultHashSize)}
+	engine.newGame()
+
+	for scanner.Scan() {
+		var line string = strings.TrimSpace(scanner.Text())
+		var fields []string = strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var arg string = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+
+		switch fields[0] {
+		case "xboard", "accepted", "rejected", "random", "hard", "easy", "computer", "name", "rating", "ics", "otim", "draw":
+		case "protover":
+			engine.send(`feature myname="` + engineName + `" ping=1 setboard=1 usermove=1 playother=1 memory=1 sigint=0 sigterm=0 san=0 colors=0 analyze=0 done=1`)
+		case "ping":
+			engine.send("pong " + arg)
+		case "post":
+			engine.post = true
+		case "nopost":
+			engine.post = false
+		case "?":
+			engine.wait(false)
+		case "new":
+			engine.wait(true)
+			engine.newGame()
+		case "force":
+			engine.wait(true)
+			engine.force = true
+		case "go":
+			engine.wait(true)
+			engine.force = false
+			engine.engine = engine.game.current().color
+			engine.think()
+		case "playother":
+			engine.wait(true)
+			engine.force = false
+			engine.engine = flipColor(engine.game.current().color)
+		case "level":
+			engine.level(fields[1:])
+		case "st":
+			engine.moveTime, _ = strconv.Atoi(arg)
+		case "sd":
+			engine.depth, _ = strconv.Atoi(arg)
+		case "time":
+			centiseconds, _ := strconv.Atoi(arg)
+			engine.clock = centiseconds * 10
+		case "usermove":
+			engine.wait(true)
+			engine.userMove(arg)
+		case "undo":
+			engine.wait(true)
+			engine.undo(1)
+		case "remove":
+			engine.wait(true)
+			engine.undo(2)
+		case "result":
+			engine.wait(true)
+			engine.force = true
+		case "setboard":
+			engine.wait(true)
+			game, err := loadFen(&arg)
+			if err != nil {
+				engine.send("tellusererror Illegal position")
+				continue
+			}
+			engine.game = newGameSession(game)
+		case "memory":
+			engine.wait(true)
+			if megabytes, err := strconv.Atoi(arg); err == nil {
+				engine.table = newTranspositionTable(min(max(megabytes, 1), maxHashSize))
+			}
+		case "quit":
+			engine.wait(true)
+			return nil
+		default:
+			//protocol version 1 sends bare moves
+			if looksLikeMove(fields[0]) {
+				engine.wait(true)
+				engine.userMove(fields[0])
+				continue
+			}
+			engine.send("Error (unknown command): " + fields[0])
+		}
+	}
+
+	engine.wait(true)
+	return scanner.Err()
+}
+
+func (e *cecpEngine) send(line string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	fmt.Fprintln(e.out, line)
+}
+
+// wait stops a running search. With discard its move is not played.
+func (e *cecpEngine) wait(discard bool) {
+	e.discard.Store(discard)
+	e.stop.Store(true)
+	e.running.Wait()
+}
+
+func (e *cecpEngine) newGame() {
+	var fen string = initialFen
+	start, _ := loadFen(&fen)
+	e.game = newGameSession(start)
+	e.table.clear()
+	e.force = false
+	e.engine = Black
+	e.depth = 0
+	e.moveTime = 0
+	e.clock = -1
+}
+
+// level handles "level MPS BASE INC", base being minutes or minutes:seconds.
+func (e *cecpEngine) level(args []string) {
+	if len(args) < 3 {
+		return
+	}
+
+	e.moves, _ = strconv.Atoi(args[0])
+
+	var minutes, seconds int
+	var parts []string = strings.Split(args[1], ":")
+	minutes, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		seconds, _ = strconv.Atoi(parts[1])
+	}
+	e.base = (minutes*60 + seconds) * 1000
+
+	increment, _ := strconv.ParseFloat(args[2], 64)
+	e.inc = int(increment * 1000)
+	e.moveTime = 0
+}
+
+func (e *cecpEngine) userMove(text string) {
+	move, err := parseUciMove(e.game.current(), text)
+	if err != nil {
+		e.send("Illegal move: " + text)
+		return
+	}
+
+	e.play(move)
+	if e.gameOver() {
+		return
+	}
+
+	if !e.force && e.game.current().color == e.engine {
+		e.think()
+	}
+}
+
+func (e *cecpEngine) play(move Move) {
+	e.game.play(move)
+}
+
+func (e *cecpEngine) undo(plies int) {
+	for i := 0; i < plies && len(e.game.moves) > 0; i++ {
+		e.game.undo()
+	}
+}
+
+// gameOver reports the result when the side to move is mated or stalemated.
+func (e *cecpEngine) gameOver() bool {
+	var game *Game = e.game.current()
+	if len(legalMoves(game, game.color)) > 0 {
+		return false
+	}
+
+	if !inCheck(*game, game.color) {
+		e.send("1/2-1/2 {Stalemate}")
+	} else if game.color == White {
+		e.send("0-1 {Black mates}")
+	} else {
+		e.send("1-0 {White mates}")
+	}
+
+	return true
+}
+
+// think searches the current position in the background and plays the
+// best move, unless the search gets aborted.
+func (e *cecpEngine) think() {
+	var game Game = *e.game.current()
+	var s *search = &search{stop: &e.stop, table: e.table, history: e.game.history()}
+	var depth int = maxSearchDepth
+	var start time.Time = time.Now()
+
+	if e.depth > 0 {
+		depth = e.depth
+	}
+	if e.moveTime > 0 {
+		s.deadline = start.Add(time.Duration(e.moveTime) * time.Second)
+	} else if e.clock >= 0 {
+		var movesToGo int = 0
+		if e.moves > 0 {
+			var played int = len(e.game.moves) / 2
+			movesToGo = e.moves - played%e.moves
+		}
+		s.deadline = start.Add(moveTime(e.clock, e.inc, movesToGo))
+	} else if e.depth == 0 {
+		depth = 3
+	}
+
+	e.stop.Store(false)
+	e.discard.Store(false)
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+
+		var best Move
+		if move, ok := bookMove(&game); ok {
+			best = move
+		} else if skill < maxSkill {
+			line, _ := s.skillMove(&game, skill)
+			best = line.move
+		} else {
+			var lines []searchLine = s.iterate(&game, depth, 1, func(depth int, lines []searchLine) {
+				if e.post {
+					e.send(cecpThinking(depth, lines[0], s.nodes, time.Since(start)))
+				}
+			})
+			if len(lines) > 0 {
+				best = lines[0].move
+			}
+		}
+
+		if e.discard.Load() || best == (Move{}) {
+			return
+		}
+
+		e.mutex.Lock()
+		e.game.play(best)
+		e.mutex.Unlock()
+
+		e.send("move " + moveToUci(best))
+		e.gameOver()
+	}()
+}
+
+// cecpThinking formats a line of thinking output: depth, score, time in
+// centiseconds, nodes and the principal variation. Mates are reported as
+// 100000 plus the moves to mate.
+func cecpThinking(depth int, line searchLine, nodes int, elapsed time.Duration) string {
+	var score int = line.Score
+	if line.Mate > 0 {
+		score = 100000 + line.Mate
+	} else if line.Mate < 0 {
+		score = -100000 + line.Mate
+	}
+
+	var pv []string
+	for _, move := range line.pv {
+		pv = append(pv, moveToUci(move))
+	}
+
+	return fmt.Sprintf("%d %d %d %d %s", depth, score, elapsed.Milliseconds()/10, nodes, strings.Join(pv, " "))
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Game struct {
@@ -46,7 +50,8 @@ type Position struct {
 }
 
 type Move struct {
-	p0, p1 Position
+	p0, p1    Position
+	promotion PieceType //0 unless a pawn reaches the last rank
 }
 
 func loadFen(fen *string) (Game, error) {
@@ -70,16 +75,29 @@ func loadFen(fen *string) (Game, error) {
 		var target string = string(array[0][i])
 
 		if target == "/" {
+			if pos_x != 8 || pos_y == 7 {
+				return Game{}, errors.New("invalid fen: rank " + strconv.Itoa(8-pos_y) + " does not have 8 squares")
+			}
 			pos_x = 0
 			pos_y++
 			continue
 		}
 
 		if v, err := strconv.Atoi(target); err == nil { //is a number
+			if v < 1 || pos_x+v > 8 {
+				return Game{}, errors.New("invalid fen: rank " + strconv.Itoa(8-pos_y) + " does not have 8 squares")
+			}
 			pos_x += v
 			continue
 		}
 
+		if !strings.Contains("pnbrqkPNBRQK", target) {
+			return Game{}, errors.New("invalid fen: unexpected " + strconv.Quote(target) + " on rank " + strconv.Itoa(8-pos_y))
+		}
+		if pos_x > 7 {
+			return Game{}, errors.New("invalid fen: rank " + strconv.Itoa(8-pos_y) + " does not have 8 squares")
+		}
+
 		switch target {
 		case "p":
 			placement[pos_x][pos_y] = Piece{piece: Pawn, color: Black}
@@ -123,6 +141,16 @@ func loadFen(fen *string) (Game, error) {
 		pos_x++
 	}
 
+	if pos_x != 8 || pos_y != 7 {
+		return Game{}, errors.New("invalid fen: the board does not have 8 ranks of 8 squares")
+	}
+
+	if array[3] != "-" {
+		if _, ok := parseSquare(array[3]); !ok {
+			return Game{}, errors.New("invalid fen: en passant square " + strconv.Quote(array[3]))
+		}
+	}
+
 	if array[1] == "w" {
 		color = White
 	} else {
@@ -131,12 +159,65 @@ func loadFen(fen *string) (Game, error) {
 
 	castling = array[2]
 	enPassant = array[3]
-	halfMove = array[4]
-	fullMove = array[5]
+	halfMove = "0"
+	fullMove = "1"
+	if len(array) > 5 { //epd positions have no move counters
+		halfMove = array[4]
+		fullMove = array[5]
+	}
 
 	return Game{placement, color, castling, enPassant, halfMove, fullMove}, nil
 }
 
+func toFen(game *Game) string {
+	var builder strings.Builder
+
+	for y := 0; y < 8; y++ {
+		var blank int = 0
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			if piece.piece == 0 {
+				blank++
+				continue
+			}
+			if blank > 0 {
+				builder.WriteString(strconv.Itoa(blank))
+				blank = 0
+			}
+			if piece.color == White {
+				builder.WriteString(strings.ToUpper(pieceLetter(piece.piece)))
+			} else {
+				builder.WriteString(pieceLetter(piece.piece))
+			}
+		}
+		if blank > 0 {
+			builder.WriteString(strconv.Itoa(blank))
+		}
+		if y < 7 {
+			builder.WriteString("/")
+		}
+	}
+
+	if game.color == White {
+		builder.WriteString(" w ")
+	} else {
+		builder.WriteString(" b ")
+	}
+
+	builder.WriteString(game.castling + " " + game.enPassant + " " + game.halfMove + " " + game.fullMove)
+	return builder.String()
+}
+
+// errorJson is the object the JSON functions return when they fail, e.g.
+// {"error":"invalid fen"}. The message is escaped by encoding/json, it may
+// echo input that is not valid JSON.
+func errorJson(err error) string {
+	data, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+	return string(data)
+}
+
 func moveToString(move Move) string {
 	if move.p0.x == 0 && move.p0.y == 0 && move.p1.x == 0 && move.p1.y == 0 {
 		return ""
@@ -148,9 +229,69 @@ func moveToString(move Move) string {
 	builder.WriteString("-")
 	builder.WriteString(fmt.Sprintf("%c", 97+move.p1.x))
 	builder.WriteString(strconv.Itoa(8 - move.p1.y))
+	if move.promotion != 0 {
+		builder.WriteString(pieceLetter(move.promotion))
+	}
 	return builder.String()
 }
 
+// moveToUci writes a move in coordinate notation as used by UCI and CECP,
+// e.g. "e2e4" or "e7e8q".
+func moveToUci(move Move) string {
+	if move == (Move{}) {
+		return "0000"
+	}
+	return squareName(move.p0) + squareName(move.p1) + pieceLetter(move.promotion)
+}
+
+// parseUciMove finds the legal move written in coordinate notation. A
+// promotion without a piece letter promotes to a queen.
+func parseUciMove(game *Game, text string) (Move, error) {
+	if len(text) < 4 || len(text) > 5 {
+		return Move{}, errors.New("invalid move " + text)
+	}
+
+	from, ok := parseSquare(text[:2])
+	to, ok2 := parseSquare(text[2:4])
+	if !ok || !ok2 {
+		return Move{}, errors.New("invalid move " + text)
+	}
+
+	var promotion PieceType = 0
+	if len(text) == 5 {
+		promotion = pieceFromLetter(text[4])
+	}
+
+	for _, move := range legalMoves(game, game.color) {
+		if move.p0 != from || move.p1 != to {
+			continue
+		}
+		if move.promotion == promotion || (promotion == 0 && move.promotion == Queen) {
+			return move, nil
+		}
+	}
+
+	return Move{}, errors.New("illegal move " + text)
+}
+
+func pieceLetter(piece PieceType) string {
+	switch piece {
+	case Pawn:
+		return "p"
+	case Knight:
+		return "n"
+	case Bishop:
+		return "b"
+	case Rook:
+		return "r"
+	case Queen:
+		return "q"
+	case King:
+		return "k"
+	}
+	return ""
+}
+
 func flipColor(color PieceColor) PieceColor {
 	if color == White {
 		return Black
@@ -216,62 +357,62 @@ func pawnMoves(game *Game, color PieceColor, p *Position) []Move {
 	if game.placement[p.x][p.y].color == White {
 
 		if game.placement[p.x][p.y-1].piece == 0 { //1 squares forward
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, p.y - 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, p.y - 1}})
 		}
 
 		if p.y == 6 && //2 squares forward
 			game.placement[p.x][p.y-2].piece == 0 && game.placement[p.x][p.y-1].piece == 0 {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, p.y - 2}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, p.y - 2}})
 		}
 
 		if p.x > 0 && //capture left
 			game.placement[p.x-1][p.y-1].piece != 0 &&
 			game.placement[p.x-1][p.y-1].color != color {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x - 1, p.y - 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x - 1, p.y - 1}})
 		}
 
 		if p.x < 7 && //capture right
 			game.placement[p.x+1][p.y-1].piece != 0 &&
 			game.placement[p.x+1][p.y-1].color != color {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x + 1, p.y - 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x + 1, p.y - 1}})
 		}
 
 		if game.enPassant != "-" { //enPassant
 			var enPassant_x int = int(byte(game.enPassant[0]) - 97)
-			var enPassant_y int = int(8 - byte(game.enPassant[1]))
-			if enPassant_y == p.y && math.Abs(float64(enPassant_x-p.x)) == 1 {
-				moves = append(moves, Move{Position{p.x, p.y}, Position{enPassant_x, enPassant_y - 1}})
+			var enPassant_y int = 8 - int(game.enPassant[1]-'0')
+			if enPassant_y == p.y-1 && math.Abs(float64(enPassant_x-p.x)) == 1 {
+				moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{enPassant_x, enPassant_y}})
 			}
 		}
 
 	} else { //black
 
 		if game.placement[p.x][p.y+1].piece == 0 { //1 squares forward
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, p.y + 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, p.y + 1}})
 		}
 
 		if p.y == 1 && //2 squares forward
 			game.placement[p.x][p.y+2].piece == 0 && game.placement[p.x][p.y+1].piece == 0 {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, p.y + 2}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, p.y + 2}})
 		}
 
 		if p.x > 0 && //capture left
 			game.placement[p.x-1][p.y+1].piece != 0 &&
 			game.placement[p.x-1][p.y+1].color != color {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x - 1, p.y + 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x - 1, p.y + 1}})
 		}
 
 		if p.x < 7 && //capture right
 			game.placement[p.x+1][p.y+1].piece != 0 &&
 			game.placement[p.x+1][p.y+1].color != color {
-			moves = append(moves, Move{Position{p.x, p.y}, Position{p.x + 1, p.y + 1}})
+			moves = appendPawnMove(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x + 1, p.y + 1}})
 		}
 
 		if game.enPassant != "-" { //enPassant
 			var enPassant_x int = int(byte(game.enPassant[0]) - 97)
-			var enPassant_y int = 8 - int(game.enPassant[1])
-			if enPassant_y == p.y && math.Abs(float64(enPassant_x-p.x)) == 1 {
-				moves = append(moves, Move{Position{p.x, p.y}, Position{enPassant_x, enPassant_y + 1}})
+			var enPassant_y int = 8 - int(game.enPassant[1]-'0')
+			if enPassant_y == p.y+1 && math.Abs(float64(enPassant_x-p.x)) == 1 {
+				moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{enPassant_x, enPassant_y}})
 			}
 		}
 	}
@@ -279,6 +420,21 @@ func pawnMoves(game *Game, color PieceColor, p *Position) []Move {
 	return moves
 }
 
+// appendPawnMove adds a pawn move, expanded into one move per promotion
+// piece when it reaches the last rank.
+func appendPawnMove(moves []Move, move Move) []Move {
+	if move.p1.y != 0 && move.p1.y != 7 {
+		return append(moves, move)
+	}
+
+	for _, piece := range []PieceType{Queen, Rook, Bishop, Knight} {
+		move.promotion = piece
+		moves = append(moves, move)
+	}
+
+	return moves
+}
+
 func knightMoves(game *Game, color PieceColor, p *Position) []Move {
 	var moves []Move
 
@@ -305,7 +461,7 @@ func knightMoves(game *Game, color PieceColor, p *Position) []Move {
 			continue
 		}
 
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 	}
 
 	return moves
@@ -324,7 +480,7 @@ func bishopMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color != color {
 			break
 		}
@@ -339,7 +495,7 @@ func bishopMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color != color {
 			break
 		}
@@ -354,7 +510,7 @@ func bishopMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color != color {
 			break
 		}
@@ -369,7 +525,7 @@ func bishopMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color != color {
 			break
 		}
@@ -385,7 +541,7 @@ func rockMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[i][p.y].piece != 0 && game.placement[i][p.y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{i, p.y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{i, p.y}})
 		if game.placement[i][p.y].piece != 0 && game.placement[i][p.y].color != color {
 			break
 		}
@@ -395,7 +551,7 @@ func rockMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[i][p.y].piece != 0 && game.placement[i][p.y].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{i, p.y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{i, p.y}})
 		if game.placement[i][p.y].piece != 0 && game.placement[i][p.y].color != color {
 			break
 		}
@@ -405,7 +561,7 @@ func rockMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[p.x][i].piece != 0 && game.placement[p.x][i].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, i}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, i}})
 		if game.placement[p.x][i].piece != 0 && game.placement[p.x][i].color != color {
 			break
 		}
@@ -415,7 +571,7 @@ func rockMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[p.x][i].piece != 0 && game.placement[p.x][i].color == color {
 			break
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{p.x, i}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{p.x, i}})
 		if game.placement[p.x][i].piece != 0 && game.placement[p.x][i].color != color {
 			break
 		}
@@ -443,7 +599,7 @@ func kingMoves(game *Game, color PieceColor, p *Position) []Move {
 		if game.placement[x][y].piece != 0 && game.placement[x][y].color == color {
 			continue
 		}
-		moves = append(moves, Move{Position{p.x, p.y}, Position{x, y}})
+		moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{x, y}})
 	}
 
 	if color == White {
@@ -452,30 +608,30 @@ func kingMoves(game *Game, color PieceColor, p *Position) []Move {
 			game.placement[1][7].piece == 0 &&
 			game.placement[2][7].piece == 0 &&
 			game.placement[3][7].piece == 0 { //white queen side castling
-			moves = append(moves, Move{Position{p.x, p.y}, Position{1, p.y}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{2, p.y}})
 		}
 
 		if strings.Index(game.castling, "K") > -1 &&
 			game.placement[7][7].piece == Rook && game.placement[7][7].color == White &&
 			game.placement[5][7].piece == 0 &&
 			game.placement[6][7].piece == 0 { //white kingside castling
-			moves = append(moves, Move{Position{p.x, p.y}, Position{6, p.y}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{6, p.y}})
 		}
 
 	} else { //black king
 		if strings.Index(game.castling, "q") > -1 &&
-			game.placement[0][0].piece == Rook && game.placement[0][7].color == Black &&
+			game.placement[0][0].piece == Rook && game.placement[0][0].color == Black &&
 			game.placement[1][0].piece == 0 &&
 			game.placement[2][0].piece == 0 &&
 			game.placement[3][0].piece == 0 { //black queen side castling
-			moves = append(moves, Move{Position{p.x, p.y}, Position{1, p.y}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{2, p.y}})
 		}
 
 		if strings.Index(game.castling, "k") > -1 &&
-			game.placement[7][0].piece == Rook && game.placement[7][7].color == Black &&
+			game.placement[7][0].piece == Rook && game.placement[7][0].color == Black &&
 			game.placement[5][0].piece == 0 &&
 			game.placement[6][0].piece == 0 { //black kingside castling
-			moves = append(moves, Move{Position{p.x, p.y}, Position{6, p.y}})
+			moves = append(moves, Move{p0: Position{p.x, p.y}, p1: Position{6, p.y}})
 		}
 	}
 
@@ -548,11 +704,18 @@ func pseudoLegalMoves(game *Game, color PieceColor) []Move {
 }
 
 func legalMoves(game *Game, color PieceColor) []Move {
-	//var enemyControl [8][8]bool = getEnemyControl(game)
+	//var enemyControl [8][8]int = getControl(game, flipColor(color))
 	var pseudoLegal []Move = pseudoLegalMoves(game, color)
 	var moves []Move
 
 	for i := 0; i < len(pseudoLegal); i++ {
+		if isCastling(game, pseudoLegal[i]) { //can't castle out of or through check
+			var through Move = Move{p0: pseudoLegal[i].p0, p1: Position{(pseudoLegal[i].p0.x + pseudoLegal[i].p1.x) / 2, pseudoLegal[i].p0.y}}
+			if inCheck(*game, color) || inCheck(makeMove(*game, through), color) {
+				continue
+			}
+		}
+
 		var clone Game = makeMove(*game, pseudoLegal[i])
 		if !inCheck(clone, color) {
 			moves = append(moves, pseudoLegal[i])
@@ -562,72 +725,45 @@ func legalMoves(game *Game, color PieceColor) []Move {
 	return moves
 }
 
-func getEnemyControl(game *Game) [8][8]bool {
-	var area [8][8]bool
-
-	var pieces []Position = getPieces(game, flipColor(game.color))
-	var moves []Move
+func isCastling(game *Game, move Move) bool {
+	return game.placement[move.p0.x][move.p0.y].piece == King && math.Abs(float64(move.p0.x-move.p1.x)) == 2
+}
 
-	for i := 0; i < len(pieces); i++ {
-		var piece Piece = game.placement[pieces[i].x][pieces[i].y]
+// getControl counts for every square the pieces of color that attack it,
+// whether it is empty, taken by the enemy or defended.
+func getControl(game *Game, color PieceColor) [8][8]int {
+	var area [8][8]int
 
-		switch piece.piece {
-		case Pawn:
-			if piece.color == White {
-				if pieces[i].x > 0 {
-					area[pieces[i].x-1][pieces[i].y-1] = true
-				}
-				if pieces[i].x < 7 {
-					area[pieces[i].x+1][pieces[i].y-1] = true
-				}
-			} else {
-				if pieces[i].x > 0 {
-					area[pieces[i].x-1][pieces[i].y+1] = true
-				}
-				if pieces[i].x < 7 {
-					area[pieces[i].x+1][pieces[i].y+1] = true
-				}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == 0 || game.placement[x][y].color != color {
+				continue
+			}
+			var p Position = Position{x, y}
+			for _, square := range attackedSquares(game, &p) {
+				area[square.x][square.y]++
 			}
-
-		case Knight:
-			var tmp []Move = knightMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
-
-		case Bishop:
-			var tmp []Move = bishopMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
-
-		case Rook:
-			var tmp []Move = rockMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
-
-		case Queen:
-			var tmp []Move = bishopMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
-
-			tmp = rockMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
-
-		case King:
-			var tmp []Move = kingMoves(game, piece.color, &pieces[i])
-			moves = append(moves, tmp...)
 		}
 	}
 
-	for i := 0; i < len(moves); i++ {
-		area[moves[i].p1.x][moves[i].p1.y] = true
-	}
-
 	return area
 }
 
 func makeMove(game Game, move Move) Game {
-	//TODO: en passant
-	//TODO: castling
-	//TODO: ...
+	//move counters
+	if game.placement[move.p0.x][move.p0.y].piece == Pawn || game.placement[move.p1.x][move.p1.y].piece != 0 {
+		game.halfMove = "0"
+	} else {
+		var halfMove, _ = strconv.Atoi(game.halfMove)
+		game.halfMove = strconv.Itoa(halfMove + 1)
+	}
+	if game.color == Black {
+		var fullMove, _ = strconv.Atoi(game.fullMove)
+		game.fullMove = strconv.Itoa(fullMove + 1)
+	}
 
-	if game.placement[move.p0.x][move.p0.y].piece == Pawn && math.Abs(float64(move.p0.y-move.p1.y)) == 2 { //en passant flag
-		game.enPassant = string([]byte{97 + byte(move.p1.x), 8 - byte(move.p1.y)})
+	if game.placement[move.p0.x][move.p0.y].piece == Pawn && math.Abs(float64(move.p0.y-move.p1.y)) == 2 { //en passant flag, the square behind the pawn
+		game.enPassant = string([]byte{97 + byte(move.p1.x), '8' - byte((move.p0.y+move.p1.y)/2)})
 	} else {
 		game.enPassant = "-"
 	}
@@ -640,10 +776,10 @@ func makeMove(game Game, move Move) Game {
 	if game.placement[move.p0.x][move.p0.y].piece == King {
 		if game.placement[move.p0.x][move.p0.y].color == White {
 			game.castling = strings.Replace(game.castling, "K", "", 1)
-			game.castling = strings.Replace(game.castling, "R", "", 1)
+			game.castling = strings.Replace(game.castling, "Q", "", 1)
 		} else {
 			game.castling = strings.Replace(game.castling, "k", "", 1)
-			game.castling = strings.Replace(game.castling, "r", "", 1)
+			game.castling = strings.Replace(game.castling, "q", "", 1)
 		}
 	}
 	if game.placement[move.p0.x][move.p0.y].piece == Rook {
@@ -663,6 +799,18 @@ func makeMove(game Game, move Move) Game {
 			}
 		}
 	}
+	if game.placement[move.p1.x][move.p1.y].piece == Rook { //rook captured on its original square
+		switch move.p1 {
+		case Position{0, 7}:
+			game.castling = strings.Replace(game.castling, "Q", "", 1)
+		case Position{7, 7}:
+			game.castling = strings.Replace(game.castling, "K", "", 1)
+		case Position{0, 0}:
+			game.castling = strings.Replace(game.castling, "q", "", 1)
+		case Position{7, 0}:
+			game.castling = strings.Replace(game.castling, "k", "", 1)
+		}
+	}
 	if len(game.castling) == 0 {
 		game.castling = "-"
 	}
@@ -695,11 +843,16 @@ func makeMove(game Game, move Move) Game {
 
 	//promote
 	if game.placement[move.p1.x][move.p1.y].piece == Pawn {
+		var promotion PieceType = move.promotion
+		if promotion == 0 {
+			promotion = Queen
+		}
+
 		if game.placement[move.p1.x][move.p1.y].color == White && move.p1.y == 0 { //white pawn
-			game.placement[move.p1.x][move.p1.y] = Piece{Queen, Black}
+			game.placement[move.p1.x][move.p1.y] = Piece{promotion, White}
 
 		} else if game.placement[move.p1.x][move.p1.y].color == Black && move.p1.y == 7 { //black pawn
-			game.placement[move.p1.x][move.p1.y] = Piece{Queen, Black}
+			game.placement[move.p1.x][move.p1.y] = Piece{promotion, Black}
 		}
 	}
 
@@ -708,6 +861,55 @@ func makeMove(game Game, move Move) Game {
 	return game
 }
 
+// gameStatus describes a position: "ongoing", "check", "checkmate",
+// "stalemate", "insufficientMaterial" or "fiftyMoveRule".
+func gameStatus(game *Game) string {
+	var check bool = inCheck(*game, game.color)
+
+	if len(legalMoves(game, game.color)) == 0 {
+		if check {
+			return "checkmate"
+		}
+		return "stalemate"
+	}
+
+	if insufficientMaterial(game) {
+		return "insufficientMaterial"
+	}
+
+	if halfMove, _ := strconv.Atoi(game.halfMove); halfMove >= 100 {
+		return "fiftyMoveRule"
+	}
+
+	if check {
+		return "check"
+	}
+	return "ongoing"
+}
+
+// insufficientMaterial is true when neither side can mate by any sequence
+// of moves: bare kings, a single minor piece, or bishops on the same color.
+func insufficientMaterial(game *Game) bool {
+	white, black := materialKeys(game)
+
+	switch white + black {
+	case "KK", "KBK", "KKB", "KNK", "KKN":
+		return true
+	case "KBKB":
+		var colors []int
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				if game.placement[x][y].piece == Bishop {
+					colors = append(colors, (x+y)%2)
+				}
+			}
+		}
+		return colors[0] == colors[1]
+	}
+
+	return false
+}
+
 func inCheck(game Game, color PieceColor) bool {
 	var kingsPosition Position
 	for y := 0; y < 8; y++ { //find king
@@ -785,139 +987,310 @@ func inCheck(game Game, color PieceColor) bool {
 	return false
 }
 
-func evaluate(game *Game) int {
-	var whitePieces []Position = getPieces(game, White)
-	var blackPieces []Position = getPieces(game, Black)
+// Mate scores are counted down by the number of plies to the mate, so
+// that a faster mate always scores higher than a slower one.
+const (
+	mateScore = 1000000
+	mateBound = mateScore - 1000 //anything beyond is a forced mate
+	infinity  = mateScore + 1
+)
 
-	var score int = 0
+// mateIn converts a search score into moves to mate. It is positive when the
+// side to move mates, negative when it gets mated and 0 for other scores,
+// but also for a position that is already checkmate: callers that report
+// mates check gameStatus for that.
+func mateIn(score int) int {
+	if score > mateBound {
+		return (mateScore - score + 1) / 2
+	}
+	if score < -mateBound {
+		return -(mateScore + score) / 2
+	}
+	return 0
+}
 
-	for i := 0; i < len(whitePieces); i++ {
-		switch game.placement[whitePieces[i].x][whitePieces[i].y].piece {
-		case Pawn:
-			score += 100
-			break
+// search holds the state of one search. A search that runs into its node
+// limit or deadline, or is stopped from outside, stops, and the scores it
+// returns from then on are meaningless.
+type search struct {
+	nodes     int
+	nodeLimit int          //0 for no limit
+	deadline  time.Time    //zero for no time limit
+	stop      *atomic.Bool //set by another goroutine to abort the search, may be nil
+	first     Move         //searched first at the root, usually the previous best move
+	yield     func()       //called every few milliseconds when set, lets a single threaded host handle events
+	lastYield time.Time
+	stopped   bool
+	table     *transpositionTable                    //may be nil, usually kept by a session between searches
+	history   []uint64                               //keys of the positions before the root and on the current line, for repetitions
+	rootMove  func(depth int, move Move, number int) //called when the search turns to the next root move, may be nil
+	quiesce   bool                                   //resolve captures beyond the depth instead of evaluating, for short searches
+
+	//statistics for the telemetry, see searchInfo
+	start        time.Time
+	selDepth     int //deepest ply reached
+	ttProbes     int
+	ttHits       int
+	cutoffs      int //beta cutoffs
+	firstCutoffs int //beta cutoffs by the first move searched
+}
 
-		case Knight:
-			score += 300
-			break
+const yieldInterval = 25 * time.Millisecond
 
-		case Bishop:
-			score += 301
-			break
+func (s *search) checkLimits() {
+	if s.nodeLimit > 0 && s.nodes > s.nodeLimit {
+		s.stopped = true
+	}
+	if s.nodes%16 == 0 {
+		if s.yield != nil && time.Since(s.lastYield) > yieldInterval {
+			s.yield()
+			s.lastYield = time.Now()
+		}
+		if (!s.deadline.IsZero() && time.Now().After(s.deadline)) || (s.stop != nil && s.stop.Load()) {
+			s.stopped = true
+		}
+	}
+}
 
-		case Rook:
-			score += 500
-			break
+func calculate(game *Game, depth int) (Move, int) {
+	var s search
+	move, score, _ := s.searchRoot(game, depth, nil)
+	return move, score
+}
 
-		case Queen:
-			score += 900
+// searchRoot finds the best root move that is not excluded, its score and
+// principal variation.
+func (s *search) searchRoot(game *Game, depth int, exclude []Move) (Move, int, []Move) {
+	var moves []Move
+	for _, move := range legalMoves(game, game.color) {
+		if !containsMove(exclude, move) {
+			moves = append(moves, move)
+		}
+	}
+
+	for i := range moves {
+		if moves[i] == s.first {
+			moves[0], moves[i] = moves[i], moves[0]
 			break
 		}
 	}
 
-	for i := 0; i < len(blackPieces); i++ {
-		switch game.placement[blackPieces[i].x][blackPieces[i].y].piece {
-		case Pawn:
-			score -= 100
+	if len(moves) == 0 {
+		if inCheck(*game, game.color) {
+			return Move{}, -mateScore, nil
+		}
+		return Move{}, 0, nil
+	}
 
-		case Knight:
-			score -= 300
-			break
+	s.history = append(s.history, polyglotKey(game))
+	defer func() { s.history = s.history[:len(s.history)-1] }()
 
-		case Bishop:
-			score -= 301
-			break
+	bestMove := moves[0]
+	bestScore := -infinity
+	var bestPv []Move
 
-		case Rook:
-			score -= 500
-			break
+	for i, move := range moves {
+		if s.rootMove != nil {
+			s.rootMove(depth, move, i+1)
+		}
 
-		case Queen:
-			score -= 900
+		clone := makeMove(*game, move)
+		var pv []Move
+		score := -s.alphaBetaPruning(&clone, depth-1, 1, -infinity, -bestScore, &pv)
+		if s.stopped {
 			break
 		}
+
+		if score > bestScore {
+			bestScore = score
+			bestMove = move
+			bestPv = append([]Move{move}, pv...)
+		}
 	}
 
-	var perspective int
-	if game.color == White {
-		perspective = 1
-	} else {
-		perspective = -1
+	return bestMove, bestScore, bestPv
+}
+
+// alphaBetaPruning is a negamax search. The score is from the point of view
+// of the side to move, ply is the distance from the root. The best line
+// found inside the window is stored in pv.
+func (s *search) alphaBetaPruning(game *Game, depth, ply int, alpha, beta int, pv *[]Move) int {
+	*pv = (*pv)[:0]
+
+	s.nodes++
+	s.selDepth = max(s.selDepth, ply)
+	s.checkLimits()
+	if s.stopped {
+		return 0
 	}
 
-	//TODO: more complex evaluation
+	//mate distance pruning, a shorter mate has already been found
+	alpha = max(alpha, -mateScore+ply)
+	beta = min(beta, mateScore-ply)
+	if alpha >= beta {
+		return alpha
+	}
 
-	return score * -perspective
-}
+	var key uint64 = polyglotKey(game)
+	if containsKey(s.history, key) { //a repetition is scored as a draw
+		return 0
+	}
+
+	if score, ok := probeTablebase(game, ply); ok {
+		return score
+	}
+
+	var hashMove Move
+	if s.table != nil && depth > 0 {
+		s.ttProbes++
+		if entry, ok := s.table.probe(key); ok {
+			s.ttHits++
+			hashMove = entry.move
+			var score int = entry.value(ply)
+			if int(entry.depth) >= depth && (entry.bound == exactBound || (entry.bound == lowerBound && score >= beta) || (entry.bound == upperBound && score <= alpha)) {
+				if entry.move != (Move{}) {
+					*pv = append(*pv, entry.move)
+				}
+				return score
+			}
+		}
+	}
+
+	var check bool = inCheck(*game, game.color)
+
+	if depth <= 0 && !check {
+		if s.quiesce {
+			return s.quiescence(game, ply, alpha, beta, pv)
+		}
+		return evaluate(game)
+	}
 
-func calculate(game *Game, depth int) (Move, int) {
 	moves := legalMoves(game, game.color)
-	bestMove := moves[0]
-	bestScore := math.MinInt32
+	if len(moves) == 0 {
+		if check { //checkmate
+			return -mateScore + ply
+		}
+		return 0 //stalemate
+	}
 
-	for _, move := range moves {
-		clone := makeMove(*game, move)
-		score := alphaBetaPruning(&clone, depth-1, math.MinInt32, math.MaxInt32, false)
-
-		if score != 0 {
-			//printPosition(&next)
-			print("d:")
-			print(depth)
-			print(" m:")
-			print(move.p1.x)
-			print(",")
-			print(move.p1.y)
-			print(" e:")
-			print(score)
-			println(" ")
-			//println("- - - - - - - -")
-			//println(" ")
+	if depth <= 0 && !s.quiesce { //in check, not mated; with quiescence the evasions are searched
+		return evaluate(game)
+	}
+
+	for i := range moves {
+		if moves[i] == hashMove {
+			moves[0], moves[i] = moves[i], moves[0]
+			break
 		}
+	}
 
+	var alphaOrig int = alpha
+	bestScore := -infinity
+	var bestMove Move
+	var line []Move
+	s.history = append(s.history, key)
+	for i, move := range moves {
+		clone := makeMove(*game, move)
+		score := -s.alphaBetaPruning(&clone, depth-1, ply+1, -beta, -alpha, &line)
 		if score > bestScore {
 			bestScore = score
 			bestMove = move
 		}
+		if score > alpha {
+			alpha = score
+			*pv = append(append((*pv)[:0], move), line...)
+		}
+		if alpha >= beta {
+			s.cutoffs++
+			if i == 0 {
+				s.firstCutoffs++
+			}
+			break
+		}
+	}
+	s.history = s.history[:len(s.history)-1]
+
+	if s.table != nil && !s.stopped {
+		var bound uint8 = exactBound
+		if bestScore <= alphaOrig {
+			bound = upperBound
+		} else if bestScore >= beta {
+			bound = lowerBound
+		}
+		s.table.store(key, depth, ply, bestScore, bound, bestMove)
 	}
 
-	return bestMove, bestScore
+	return bestScore
 }
 
-func alphaBetaPruning(game *Game, depth int, alpha, beta int, maximizingPlayer bool) int {
-	if depth == 0 {
-		return evaluate(game)
+// quiescence searches only captures, most valuable victim first, until the
+// position is quiet, so that a short search does not stop in the middle
+// of an exchange. The side to move may also stand pat on the evaluation.
+// The captures played are stored in pv.
+func (s *search) quiescence(game *Game, ply int, alpha, beta int, pv *[]Move) int {
+	*pv = (*pv)[:0]
+
+	s.nodes++
+	s.selDepth = max(s.selDepth, ply)
+	s.checkLimits()
+	if s.stopped {
+		return 0
 	}
 
-	moves := legalMoves(game, game.color)
-	if !maximizingPlayer {
-		moves = legalMoves(game, flipColor(game.color))
-	}
-
-	if maximizingPlayer {
-		maxScore := math.MinInt32
-		for _, move := range moves {
-			clone := makeMove(*game, move)
-			score := alphaBetaPruning(&clone, depth-1, alpha, beta, false)
-			maxScore = max(maxScore, score)
-			alpha = max(alpha, score)
-			if beta <= alpha {
-				break
-			}
+	var standPat int = evaluate(game)
+	if standPat >= beta {
+		return standPat
+	}
+	alpha = max(alpha, standPat)
+
+	var captures []Move
+	for _, move := range legalMoves(game, game.color) {
+		var piece Piece = game.placement[move.p0.x][move.p0.y]
+		if game.placement[move.p1.x][move.p1.y].piece != 0 || (piece.piece == Pawn && move.p0.x != move.p1.x) {
+			captures = append(captures, move)
 		}
-		return maxScore
-	} else {
-		minScore := math.MaxInt32
-		for _, move := range moves {
-			clone := makeMove(*game, move)
-			score := alphaBetaPruning(&clone, depth-1, alpha, beta, true)
-			minScore = min(minScore, score)
-			beta = min(beta, score)
-			if beta <= alpha {
-				break
-			}
+	}
+	sort.SliceStable(captures, func(i, j int) bool {
+		var a, b Move = captures[i], captures[j]
+		var victimA, victimB int = pieceValue(game.placement[a.p1.x][a.p1.y].piece), pieceValue(game.placement[b.p1.x][b.p1.y].piece)
+		if victimA != victimB {
+			return victimA > victimB
+		}
+		return exchangeValue(game.placement[a.p0.x][a.p0.y].piece) < exchangeValue(game.placement[b.p0.x][b.p0.y].piece)
+	})
+
+	var line []Move
+	for _, move := range captures {
+		clone := makeMove(*game, move)
+		score := -s.quiescence(&clone, ply+1, -beta, -alpha, &line)
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+			*pv = append(append((*pv)[:0], move), line...)
 		}
-		return minScore
 	}
+
+	return alpha
+}
+
+func containsMove(moves []Move, move Move) bool {
+	for _, m := range moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+func containsKey(keys []uint64, key uint64) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 func randomMove(game *Game) Move {
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+// perft counts the leaf nodes of the legal move tree to depth.
+func perft(game *Game, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	var nodes int = 0
+	for _, move := range legalMoves(game, game.color) {
+		var next Game = makeMove(*game, move)
+		nodes += perft(&next, depth-1)
+	}
+	return nodes
+}
+
+// The reference counts of the Chess Programming Wiki, they cover castling,
+// en passant, promotions and checks.
+func TestPerft(t *testing.T) {
+	var tests = []struct {
+		name  string
+		fen   string
+		nodes []int //by depth, from 1
+	}{
+		{"startpos", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []int{20, 400, 8902, 197281}},
+		{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+		{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238}},
+		{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+		{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379}},
+	}
+
+	for _, test := range tests {
+		var fen string = test.fen
+		game, err := loadFen(&fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for depth, want := range test.nodes {
+			if got := perft(&game, depth+1); got != want {
+				t.Errorf("%s: perft(%d) = %d, want %d", test.name, depth+1, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadFenErrors(t *testing.T) {
+	var fens []string = []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR/8 w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnrr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e9 0 1",
+	}
+
+	for _, fen := range fens {
+		if _, err := loadFen(&fen); err == nil {
+			t.Errorf("%q: no error", fen)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Short English sentences about a move, from what it captures, the
+// tactics it creates, the pieces it leaves hanging and what a short search
+// thinks of it, e.g. "Nxe5 wins a pawn and forks the king and rook."
+
+type moveComment struct {
+	Move      string   `json:"move"`
+	San       string   `json:"san"`
+	Comment   string   `json:"comment"`   //the sentences joined
+	Sentences []string `json:"sentences"` //the first one always starts with the SAN
+	Tactics   []tactic `json:"tactics"`
+	Gain      int      `json:"gain"` //see tacticsReport
+}
+
+// pieceList names pieces for a sentence, e.g. "the king and rook".
+func pieceList(game *Game, squares []string) string {
+	var names []string
+	for _, name := range squares {
+		if p, ok := parseSquare(name); ok {
+			names = append(names, pieceName(game.placement[p.x][p.y].piece))
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return "the " + names[0]
+	}
+	return "the " + strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// tacticClause is what a tactic does, as the predicate of a sentence.
+func tacticClause(game *Game, t tactic) string {
+	switch t.Motif {
+	case motifFork:
+		return "forks " + pieceList(game, t.Targets)
+	case motifAbsolutePin:
+		return "pins " + pieceList(game, t.Targets) + " to the king"
+	case motifRelativePin:
+		return "pins " + pieceList(game, t.Targets[:1]) + " to " + pieceList(game, t.Targets[1:])
+	case motifSkewer:
+		return "skewers " + pieceList(game, t.Targets)
+	case motifDiscoveredAttack:
+		p, _ := parseSquare(t.Square)
+		return "uncovers an attack of the " + pieceName(game.placement[p.x][p.y].piece) + " on " + pieceList(game, t.Targets)
+	case motifDiscoveredCheck:
+		return "gives discovered check"
+	case motifDoubleCheck:
+		return "gives double check"
+	case motifRemovalOfDefender:
+		return "removes the defender of " + pieceList(game, t.Targets)
+	}
+	return ""
+}
+
+// captureClause describes the material a capture wins or gives up, counting
+// the recapture if it pays for the opponent.
+func captureClause(game *Game, next *Game, move Move, flags moveFlags, sound bool) string {
+	var mover PieceType = game.placement[move.p0.x][move.p0.y].piece
+	var captured PieceType = Pawn
+	if !flags.EnPassant {
+		captured = game.placement[move.p1.x][move.p1.y].piece
+	}
+
+	var net int = exchangeValue(captured) - max(see(next, move.p1, next.color), 0)
+	switch {
+	case net >= exchangeValue(captured)-tradeMargin:
+		return "wins a " + pieceName(captured)
+	case net > tradeMargin:
+		return "wins material"
+	case net >= -tradeMargin && mover == captured:
+		return "exchanges " + pieceName(captured) + "s"
+	case net >= -tradeMargin:
+		return "trades the " + pieceName(mover) + " for the " + pieceName(captured)
+	case sound:
+		return "sacrifices the " + pieceName(mover)
+	}
+	return "gives up the " + pieceName(mover) + " for a " + pieceName(captured)
+}
+
+const tradeMargin = 30 //centipawns between pieces that count as an even trade
+
+// quietClause says what a move without captures or tactics does.
+func quietClause(game *Game, move Move, flags moveFlags) string {
+	var piece Piece = game.placement[move.p0.x][move.p0.y]
+	var home int = 7
+	if piece.color == Black {
+		home = 0
+	}
+
+	switch {
+	case flags.Castle != "":
+		return "castles " + flags.Castle
+	case flags.Promotion != "":
+		return ""
+	case piece.piece == Pawn:
+		return "advances the pawn"
+	case (piece.piece == Knight || piece.piece == Bishop) && move.p0.y == home:
+		return "develops the " + pieceName(piece.piece)
+	}
+	return "brings the " + pieceName(piece.piece) + " to " + squareName(move.p1)
+}
+
+func commentMove(game *Game, move Move) moveComment {
+	var report tacticsReport = moveTactics(game, move)
+	next, flags := makeMoveFlags(*game, move)
+	var enemy PieceColor = next.color
+	var comment moveComment = moveComment{Move: report.Move, San: report.San, Sentences: []string{}, Tactics: report.Tactics, Gain: report.Gain}
+
+	var say = func(sentence string) {
+		comment.Sentences = append(comment.Sentences, sentence)
+	}
+
+	if flags.Checkmate {
+		var kind string = "checkmate"
+		for _, t := range report.Tactics {
+			if t.Motif == motifBackRankMate {
+				kind = "a back-rank mate"
+			} else if t.Motif == motifSmotheredMate {
+				kind = "a smothered mate"
+			}
+		}
+		say(report.San + " is " + kind + ".")
+		comment.Comment = strings.Join(comment.Sentences, " ")
+		return comment
+	}
+
+	var clauses []string
+	var checked bool = false //a clause already tells about the check
+	if flags.Capture {
+		clauses = append(clauses, captureClause(game, &next, move, flags, report.Sound))
+	}
+	if flags.Promotion != "" {
+		clauses = append(clauses, "promotes to a "+pieceName(next.placement[move.p1.x][move.p1.y].piece))
+	}
+	for _, t := range report.Tactics {
+		if clause := tacticClause(&next, t); clause != "" {
+			clauses = append(clauses, clause)
+			checked = checked || t.Motif == motifDiscoveredCheck || t.Motif == motifDoubleCheck ||
+				((t.Motif == motifFork || t.Motif == motifSkewer) && strings.Contains(clause, "king"))
+		}
+	}
+	if flags.Check && !checked {
+		clauses = append(clauses, "gives check")
+	}
+
+	//pieces the move leaves to be taken, a sacrifice if the move is sound
+	var hanging []string
+	for _, p := range getPieces(&next, game.color) {
+		var piece Piece = next.placement[p.x][p.y]
+		if piece.piece == 0 || piece.piece == King || see(&next, p, enemy) <= 0 {
+			continue
+		}
+		if p != move.p1 && see(game, p, enemy) > 0 {
+			continue //it was hanging before
+		}
+		if p == move.p1 && flags.Capture {
+			continue //the capture clause counts the recapture
+		}
+		if report.Sound && p == move.p1 && !flags.Capture {
+			clauses = append(clauses, "sacrifices the "+pieceName(piece.piece))
+		} else if !report.Sound {
+			hanging = append(hanging, "the "+pieceName(piece.piece)+" on "+squareName(p))
+		}
+	}
+
+	if len(clauses) == 0 {
+		if clause := quietClause(game, move, flags); clause != "" {
+			clauses = append(clauses, clause)
+		}
+	}
+	say(report.San + " " + joinClauses(clauses) + ".")
+
+	if len(hanging) > 0 {
+		say("This move hangs " + joinClauses(hanging) + ".")
+	} else if report.Sound && !flags.Capture {
+		say("It wins material.")
+	} else if report.Gain <= -tacticMargin && !flags.Capture {
+		say("It loses material.")
+	}
+
+	comment.Comment = strings.Join(comment.Sentences, " ")
+	return comment
+}
+
+// joinClauses joins with commas and a final "and".
+func joinClauses(clauses []string) string {
+	if len(clauses) <= 1 {
+		return strings.Join(clauses, "")
+	}
+	return strings.Join(clauses[:len(clauses)-1], ", ") + " and " + clauses[len(clauses)-1]
+}
+
+// commentJson comments on move in the current position of a game, given as
+// for parseGameSession, or on every move of the game if move is empty.
+func commentJson(position string, move string) (string, error) {
+	g, err := parseGameSession(position)
+	if err != nil {
+		return "", err
+	}
+
+	var data []byte
+	if move != "" {
+		parsed, err := parseMove(g.current(), move)
+		if err != nil {
+			return "", err
+		}
+		data, err = json.Marshal(commentMove(g.current(), parsed))
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var comments []moveComment = []moveComment{}
+		for i, played := range g.moves {
+			comments = append(comments, commentMove(&g.positions[i], played))
+		}
+		data, err = json.Marshal(comments)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Specialized endgame knowledge. The material on the board is reduced to a
+// signature such as "KRKP" (white's pieces, then black's, each ordered
+// KQRBNP) and looked up in the tables below, strong side first, so "KQK"
+// also covers a black queen against a lone white king.
+
+// knownWin lifts recognized wins above any normal evaluation, while staying
+// far below mate scores.
+const knownWin = 10000
+
+type endgameEvaluator func(game *Game, strong PieceColor) int //score for the strong side
+type endgameScaler func(game *Game, strong PieceColor) int    //0 (draw) to 64 (unchanged)
+
+var endgameEvaluators map[string]endgameEvaluator = map[string]endgameEvaluator{
+	"KPK":  evaluateKPK,
+	"KQK":  evaluateKXK,
+	"KRK":  evaluateKXK,
+	"KQQK": evaluateKXK,
+	"KQRK": evaluateKXK,
+	"KRRK": evaluateKXK,
+	"KBBK": evaluateKBBK,
+	"KBNK": evaluateKBNK,
+	"KK":   evaluateDraw,
+	"KBK":  evaluateDraw,
+	"KNK":  evaluateDraw,
+	"KNNK": evaluateDraw,
+}
+
+var endgameScalers map[string]endgameScaler = map[string]endgameScaler{
+	"KBPK":   scaleWrongRookPawn,
+	"KBPPK":  scaleWrongRookPawn,
+	"KBPPPK": scaleWrongRookPawn,
+	"KBKB":   scaleDraw,
+	"KBKN":   scaleDraw,
+	"KNKB":   scaleDraw,
+	"KNKN":   scaleDraw,
+	"KNNKB":  scaleDraw,
+	"KNNKN":  scaleDraw,
+}
+
+// materialKeys returns the pieces of each side ordered KQRBNP.
+func materialKeys(game *Game) (string, string) {
+	var counts [2][6]int
+	var order []PieceType = []PieceType{King, Queen, Rook, Bishop, Knight, Pawn}
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			for i := 0; i < len(order); i++ {
+				if piece.piece == order[i] {
+					counts[piece.color][i]++
+				}
+			}
+		}
+	}
+
+	var keys [2]string
+	for color := 0; color < 2; color++ {
+		var builder strings.Builder
+		for i := 0; i < len(order); i++ {
+			builder.WriteString(strings.Repeat(strings.ToUpper(pieceLetter(order[i])), counts[color][i]))
+		}
+		keys[color] = builder.String()
+	}
+
+	return keys[White], keys[Black]
+}
+
+// materialKey returns the material signature of a position, white first.
+func materialKey(game *Game) string {
+	white, black := materialKeys(game)
+	return white + black
+}
+
+// applyEndgame replaces or scales the score in trace when the material on
+// the board matches a known endgame.
+func applyEndgame(game *Game, trace *evalTrace) {
+	white, black := materialKeys(game)
+	trace.Scale = 64
+
+	if evaluator, ok := endgameEvaluators[white+black]; ok {
+		trace.Endgame = white + black
+		trace.Score = evaluator(game, White)
+		return
+	}
+	if evaluator, ok := endgameEvaluators[black+white]; ok {
+		trace.Endgame = black + white
+		trace.Score = -evaluator(game, Black)
+		return
+	}
+
+	if white == "K" && hasMatingMaterial(game, Black, black) {
+		trace.Endgame = black + white
+		trace.Score = -evaluateKXK(game, Black)
+		return
+	}
+	if black == "K" && hasMatingMaterial(game, White, white) {
+		trace.Endgame = white + black
+		trace.Score = evaluateKXK(game, White)
+		return
+	}
+
+	var strong PieceColor = White
+	var strongKey, weakKey string = white, black
+	if trace.Score < 0 {
+		strong = Black
+		strongKey, weakKey = black, white
+	}
+
+	if scaler, ok := endgameScalers[strongKey+weakKey]; ok {
+		trace.Endgame = strongKey + weakKey
+		trace.Scale = scaler(game, strong)
+	} else if strongKey == "K" || strongKey == "KN" || strongKey == "KB" { //can't mate
+		trace.Scale = 0
+	} else if oppositeBishops(game, white, black) {
+		trace.Scale = 48
+		if strings.Trim(white, "KBP") == "" && strings.Trim(black, "KBP") == "" { //bishops and pawns only
+			trace.Scale = 24
+		}
+	}
+
+	trace.Score = trace.Score * trace.Scale / 64
+}
+
+// hasMatingMaterial tells if a side can force mate against a lone king.
+// Bishops only mate together if they move on squares of both colors.
+func hasMatingMaterial(game *Game, color PieceColor, key string) bool {
+	return strings.ContainsAny(key, "QR") ||
+		bishopColors(game, color) == 3 ||
+		(strings.Contains(key, "B") && strings.Contains(key, "N"))
+}
+
+// bishopColors tells the square colors the bishops of color move on: 1 for
+// light squares, 2 for dark ones, 3 for both and 0 without bishops.
+func bishopColors(game *Game, color PieceColor) int {
+	var colors int = 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == Bishop && game.placement[x][y].color == color {
+				colors |= 1 << ((x + y) % 2)
+			}
+		}
+	}
+	return colors
+}
+
+func evaluateDraw(game *Game, strong PieceColor) int {
+	return 0
+}
+
+func scaleDraw(game *Game, strong PieceColor) int {
+	return 0
+}
+
+// evaluateKXK drives the lone king to the edge and brings the strong king
+// closer, which is all a shallow search needs to find the mate.
+func evaluateKXK(game *Game, strong PieceColor) int {
+	var strongKing, weakKing Position = findKing(game, strong), findKing(game, flipColor(strong))
+	var score int = knownWin + sideMaterial(game, strong)
+
+	score += 20 * centerDistance(weakKing)
+	score += 10 * (7 - distance(strongKing, weakKing))
+
+	return score
+}
+
+// evaluateKBBK is a win with bishops of both colors, two bishops on
+// squares of the same color cannot force mate.
+func evaluateKBBK(game *Game, strong PieceColor) int {
+	if bishopColors(game, strong) != 3 {
+		return 0
+	}
+	return evaluateKXK(game, strong)
+}
+
+// evaluateKBNK drives the lone king to a corner of the bishop's color.
+func evaluateKBNK(game *Game, strong PieceColor) int {
+	var strongKing, weakKing Position = findKing(game, strong), findKing(game, flipColor(strong))
+	var score int = knownWin + sideMaterial(game, strong)
+
+	var corners [2]Position = [2]Position{{0, 0}, {7, 7}} //a8 and h1 are light squares
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == Bishop && (x+y)%2 == 1 {
+				corners = [2]Position{{7, 0}, {0, 7}}
+			}
+		}
+	}
+
+	score += 20 * (7 - min(distance(weakKing, corners[0]), distance(weakKing, corners[1])))
+	score += 10 * (7 - distance(strongKing, weakKing))
+
+	return score
+}
+
+func evaluateKPK(game *Game, strong PieceColor) int {
+	var strongKing, weakKing Position = findKing(game, strong), findKing(game, flipColor(strong))
+	var pawn Position
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == Pawn {
+				pawn = Position{x, y}
+			}
+		}
+	}
+
+	if !probeKPK(strongKing, pawn, weakKing, strong, game.color == strong) {
+		return 0
+	}
+
+	var rank int = 7 - pawn.y
+	if strong == Black {
+		rank = pawn.y
+	}
+
+	return knownWin + params.Pawn[endgame] + 10*rank
+}
+
+// scaleWrongRookPawn recognizes a bishop with rook pawns that can't
+// promote because the bishop doesn't control the corner the defending king
+// holds.
+func scaleWrongRookPawn(game *Game, strong PieceColor) int {
+	var file int = -1
+	var bishopColor int = 0
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			if piece.color != strong {
+				continue
+			}
+			if piece.piece == Pawn {
+				if (x != 0 && x != 7) || (file != -1 && file != x) {
+					return 64
+				}
+				file = x
+			}
+			if piece.piece == Bishop {
+				bishopColor = (x + y) % 2
+			}
+		}
+	}
+
+	var corner Position = Position{file, 0}
+	if strong == Black {
+		corner = Position{file, 7}
+	}
+
+	if (corner.x+corner.y)%2 != bishopColor && distance(findKing(game, flipColor(strong)), corner) <= 1 {
+		return 0
+	}
+
+	return 64
+}
+
+// oppositeBishops tells if each side has exactly one bishop and they move
+// on squares of different colors.
+func oppositeBishops(game *Game, white, black string) bool {
+	if strings.Count(white, "B") != 1 || strings.Count(black, "B") != 1 {
+		return false
+	}
+
+	var colors [2]int
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == Bishop {
+				colors[game.placement[x][y].color] = (x + y) % 2
+			}
+		}
+	}
+
+	return colors[White] != colors[Black]
+}
+
+func sideMaterial(game *Game, color PieceColor) int {
+	var score int = 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].color == color {
+				score += pieceValue(game.placement[x][y].piece)
+			}
+		}
+	}
+	return score
+}
+
+// pieceValue is the endgame material value of a piece.
+func pieceValue(piece PieceType) int {
+	switch piece {
+	case Pawn:
+		return params.Pawn[endgame]
+	case Knight:
+		return params.Knight[endgame]
+	case Bishop:
+		return params.Bishop[endgame]
+	case Rook:
+		return params.Rook[endgame]
+	case Queen:
+		return params.Queen[endgame]
+	}
+	return 0
+}
+
+func findKing(game *Game, color PieceColor) Position {
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == King && game.placement[x][y].color == color {
+				return Position{x, y}
+			}
+		}
+	}
+	return Position{}
+}
+
+// distance is the number of king moves between two squares.
+func distance(a, b Position) int {
+	return max(abs(a.x-b.x), abs(a.y-b.y))
+}
+
+// centerDistance is 0 on the four center squares and 3 on the edge.
+func centerDistance(p Position) int {
+	return max(abs(2*p.x-7), abs(2*p.y-7)) / 2
+}
+
+// KPK bitbase. Positions are indexed with white as the side with the pawn,
+// the pawn on files a-d and squares numbered y*8+x as on the board.
+
+const (
+	kpkUnknown = iota
+	kpkInvalid
+	kpkDraw
+	kpkWin
+)
+
+var kpkOnce sync.Once
+var kpkBits []uint64 //one bit per position, set when white wins
+
+func kpkIndex(whiteToMove bool, whiteKing, pawn, blackKing int) int {
+	var index int = whiteKing | blackKing<<6 | (pawn%8)<<12 | (6-pawn/8)<<14
+	if whiteToMove {
+		index |= 1 << 17
+	}
+	return index
+}
+
+// probeKPK tells if the side with the pawn wins.
+func probeKPK(strongKing, pawn, weakKing Position, strong PieceColor, strongToMove bool) bool {
+	kpkOnce.Do(generateKPK)
+
+	if strong == Black { //flip the board so the pawn moves up
+		strongKing.y, pawn.y, weakKing.y = 7-strongKing.y, 7-pawn.y, 7-weakKing.y
+	}
+	if pawn.x > 3 {
+		strongKing.x, pawn.x, weakKing.x = 7-strongKing.x, 7-pawn.x, 7-weakKing.x
+	}
+
+	var index int = kpkIndex(strongToMove, strongKing.y*8+strongKing.x, pawn.y*8+pawn.x, weakKing.y*8+weakKing.x)
+	return kpkBits[index/64]&(1<<(index%64)) != 0
+}
+
+func generateKPK() {
+	var size int = 1 << 18
+	var db []byte = make([]byte, size)
+
+	for index := 0; index < size; index++ {
+		db[index] = kpkClassifyInitial(index)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for index := 0; index < size; index++ {
+			if db[index] == kpkUnknown {
+				db[index] = kpkClassify(db, index)
+				changed = changed || db[index] != kpkUnknown
+			}
+		}
+	}
+
+	kpkBits = make([]uint64, size/64)
+	for index := 0; index < size; index++ {
+		if db[index] == kpkWin {
+			kpkBits[index/64] |= 1 << (index % 64)
+		}
+	}
+}
+
+func kpkDecode(index int) (bool, Position, Position, Position) {
+	var whiteKing Position = Position{index & 7, (index >> 3) & 7}
+	var blackKing Position = Position{(index >> 6) & 7, (index >> 9) & 7}
+	var pawn Position = Position{(index >> 12) & 3, 6 - (index>>14)&7}
+	return index&(1<<17) != 0, whiteKing, pawn, blackKing
+}
+
+func kpkPawnAttacks(pawn, p Position) bool {
+	return p.y == pawn.y-1 && abs(p.x-pawn.x) == 1
+}
+
+func kpkClassifyInitial(index int) byte {
+	whiteToMove, whiteKing, pawn, blackKing := kpkDecode(index)
+
+	if (index>>14)&7 > 5 || //pawn on the last ranks
+		distance(whiteKing, blackKing) <= 1 ||
+		whiteKing == pawn || blackKing == pawn ||
+		(whiteToMove && kpkPawnAttacks(pawn, blackKing)) {
+		return kpkInvalid
+	}
+
+	if whiteToMove && pawn.y == 1 { //promotes unless the new queen is lost
+		var queen Position = Position{pawn.x, 0}
+		if whiteKing != queen && blackKing != queen &&
+			(distance(blackKing, queen) > 1 || distance(whiteKing, queen) == 1) {
+			return kpkWin
+		}
+	}
+
+	if !whiteToMove {
+		if distance(blackKing, pawn) == 1 && distance(whiteKing, pawn) > 1 { //takes the pawn
+			return kpkDraw
+		}
+
+		var moves int = 0
+		for _, p := range kingSteps(blackKing) {
+			if distance(p, whiteKing) > 1 && !kpkPawnAttacks(pawn, p) {
+				moves++
+			}
+		}
+		if moves == 0 && !kpkPawnAttacks(pawn, blackKing) { //stalemate
+			return kpkDraw
+		}
+	}
+
+	return kpkUnknown
+}
+
+// kpkClassify resolves a position from its successors: the side to move
+// reaches its best outcome if any move does, the other one if all do.
+func kpkClassify(db []byte, index int) byte {
+	whiteToMove, whiteKing, pawn, blackKing := kpkDecode(index)
+	var good, bad byte = kpkWin, kpkDraw
+	if !whiteToMove {
+		good, bad = kpkDraw, kpkWin
+	}
+
+	var result byte = bad
+	var visit = func(wk, p, bk Position) {
+		var next byte = db[kpkIndex(!whiteToMove, wk.y*8+wk.x, p.y*8+p.x, bk.y*8+bk.x)]
+		if next == good {
+			result = good
+		} else if next == kpkUnknown && result != good {
+			result = kpkUnknown
+		}
+	}
+
+	if whiteToMove {
+		for _, p := range kingSteps(whiteKing) {
+			if p != pawn && distance(p, blackKing) > 1 {
+				visit(p, pawn, blackKing)
+			}
+		}
+
+		var push Position = Position{pawn.x, pawn.y - 1}
+		if pawn.y > 1 && push != whiteKing && push != blackKing {
+			visit(whiteKing, push, blackKing)
+
+			var double Position = Position{pawn.x, pawn.y - 2}
+			if pawn.y == 6 && double != whiteKing && double != blackKing {
+				visit(whiteKing, double, blackKing)
+			}
+		}
+	} else {
+		for _, p := range kingSteps(blackKing) {
+			if p != pawn && distance(p, whiteKing) > 1 && !kpkPawnAttacks(pawn, p) {
+				visit(whiteKing, pawn, p)
+			}
+		}
+	}
+
+	return result
+}
+
+func kingSteps(p Position) []Position {
+	var steps []Position
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			var x, y int = p.x + dx, p.y + dy
+			if (dx != 0 || dy != 0) && x >= 0 && x < 8 && y >= 0 && y < 8 {
+				steps = append(steps, Position{x, y})
+			}
+		}
+	}
+	return steps
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+const (
+	middlegame = 0
+	endgame    = 1
+)
+
+const maxPhase = 24
+
+type evalScore struct {
+	Mg int `json:"mg"`
+	Eg int `json:"eg"`
+}
+
+func (s *evalScore) add(weight [2]int, n int) {
+	s.Mg += weight[middlegame] * n
+	s.Eg += weight[endgame] * n
+}
+
+type evalTerm struct {
+	White evalScore `json:"white"`
+	Black evalScore `json:"black"`
+	Score int       `json:"score"` //tapered, white minus black
+}
+
+func (t *evalTerm) side(color PieceColor) *evalScore {
+	if color == White {
+		return &t.White
+	}
+	return &t.Black
+}
+
+// evalTrace is the breakdown of a static evaluation. evaluate and explain
+// both read it, so the explanation is the one the engine goes by. The terms
+// add up to mg and eg, the score is those tapered by the phase and then
+// multiplied by scale/64, unless a recognized endgame replaces it.
+type evalTrace struct {
+	Material      evalTerm `json:"material"`
+	PieceSquare   evalTerm `json:"pieceSquare"`
+	PawnStructure evalTerm `json:"pawnStructure"`
+	KingSafety    evalTerm `json:"kingSafety"`
+	Mobility      evalTerm `json:"mobility"`
+	Phase         int      `json:"phase"` //24 full middlegame, 0 bare endgame
+	Mg            int      `json:"mg"`
+	Eg            int      `json:"eg"`
+	Endgame       string   `json:"endgame,omitempty"` //recognized material signature
+	Scale         int      `json:"scale"`             //64 unless the material is drawish
+	Score         int      `json:"score"`             //white's point of view
+}
+
+func (t *evalTrace) terms() []*evalTerm {
+	return []*evalTerm{&t.Material, &t.PieceSquare, &t.PawnStructure, &t.KingSafety, &t.Mobility}
+}
+
+func evaluate(game *Game) int {
+	var score int = whiteScore(game)
+
+	var perspective int
+	if game.color == White {
+		perspective = 1
+	} else {
+		perspective = -1
+	}
+
+	return score * perspective //negamax, from the side to move
+}
+
+// whiteScore is the static evaluation from white's point of view.
+func whiteScore(game *Game) int {
+	var trace evalTrace = traceEvaluation(game)
+	return trace.Score
+}
+
+// explain returns the evaluation breakdown of a position as JSON.
+func explain(fen string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	var trace evalTrace = traceEvaluation(&game)
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func traceEvaluation(game *Game) evalTrace {
+	var trace evalTrace
+	var pawns [2][8]int //pawns per file, indexed by color
+	var kings [2]Position
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			if piece.piece == 0 {
+				continue
+			}
+
+			var square int = y*8 + x
+			if piece.color == Black {
+				square = (7-y)*8 + x
+			}
+
+			var material *evalScore = trace.Material.side(piece.color)
+			var pieceSquare *evalScore = trace.PieceSquare.side(piece.color)
+			var mobility *evalScore = trace.Mobility.side(piece.color)
+			var p Position = Position{x, y}
+
+			switch piece.piece {
+			case Pawn:
+				material.add(params.Pawn, 1)
+				pieceSquare.add(tableEntry(&params.PawnTable, square), 1)
+				pawns[piece.color][x]++
+
+			case Knight:
+				material.add(params.Knight, 1)
+				pieceSquare.add(tableEntry(&params.KnightTable, square), 1)
+				mobility.add(params.KnightMobility, len(knightMoves(game, piece.color, &p)))
+				trace.Phase += 1
+
+			case Bishop:
+				material.add(params.Bishop, 1)
+				pieceSquare.add(tableEntry(&params.BishopTable, square), 1)
+				mobility.add(params.BishopMobility, len(bishopMoves(game, piece.color, &p)))
+				trace.Phase += 1
+
+			case Rook:
+				material.add(params.Rook, 1)
+				pieceSquare.add(tableEntry(&params.RookTable, square), 1)
+				mobility.add(params.RookMobility, len(rockMoves(game, piece.color, &p)))
+				trace.Phase += 2
+
+			case Queen:
+				material.add(params.Queen, 1)
+				pieceSquare.add(tableEntry(&params.QueenTable, square), 1)
+				mobility.add(params.QueenMobility, len(bishopMoves(game, piece.color, &p))+len(rockMoves(game, piece.color, &p)))
+				trace.Phase += 4
+
+			case King:
+				pieceSquare.add(tableEntry(&params.KingTable, square), 1)
+				kings[piece.color] = p
+			}
+		}
+	}
+
+	if trace.Phase > maxPhase { //early promotions
+		trace.Phase = maxPhase
+	}
+
+	for _, color := range []PieceColor{White, Black} {
+		evaluatePawnStructure(game, color, &pawns, trace.PawnStructure.side(color))
+		evaluateKingSafety(game, color, &kings[color], trace.KingSafety.side(color))
+	}
+
+	for _, term := range trace.terms() {
+		term.Score = taper(term.White.Mg-term.Black.Mg, term.White.Eg-term.Black.Eg, trace.Phase)
+		trace.Mg += term.White.Mg - term.Black.Mg
+		trace.Eg += term.White.Eg - term.Black.Eg
+	}
+
+	trace.Score = taper(trace.Mg, trace.Eg, trace.Phase)
+	applyEndgame(game, &trace)
+
+	return trace
+}
+
+func taper(mg, eg, phase int) int {
+	return (mg*phase + eg*(maxPhase-phase)) / maxPhase
+}
+
+func tableEntry(table *[2][64]int, square int) [2]int {
+	return [2]int{table[middlegame][square], table[endgame][square]}
+}
+
+func evaluatePawnStructure(game *Game, color PieceColor, pawns *[2][8]int, score *evalScore) {
+	var enemy PieceColor = flipColor(color)
+
+	for x := 0; x < 8; x++ {
+		if pawns[color][x] == 0 {
+			continue
+		}
+
+		if pawns[color][x] > 1 {
+			score.add(params.DoubledPawn, pawns[color][x]-1)
+		}
+
+		if (x == 0 || pawns[color][x-1] == 0) && (x == 7 || pawns[color][x+1] == 0) {
+			score.add(params.IsolatedPawn, pawns[color][x])
+		}
+	}
+
+	for y := 1; y < 7; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece != Pawn || game.placement[x][y].color != color {
+				continue
+			}
+
+			var passed bool = true
+			for fx := max(x-1, 0); fx <= min(x+1, 7) && passed; fx++ {
+				for fy := 1; fy < 7; fy++ {
+					var ahead bool = (color == White && fy < y) || (color == Black && fy > y)
+					if ahead && game.placement[fx][fy].piece == Pawn && game.placement[fx][fy].color == enemy {
+						passed = false
+						break
+					}
+				}
+			}
+
+			if passed {
+				var rank int = 7 - y
+				if color == Black {
+					rank = y
+				}
+				score.Mg += params.PassedPawn[middlegame][rank]
+				score.Eg += params.PassedPawn[endgame][rank]
+			}
+		}
+	}
+}
+
+func evaluateKingSafety(game *Game, color PieceColor, king *Position, score *evalScore) {
+	var forward int = -1
+	if color == Black {
+		forward = 1
+	}
+
+	//pawns in front of the king
+	var shield int = 0
+	for x := king.x - 1; x <= king.x+1; x++ {
+		for step := 1; step <= 2; step++ {
+			var y int = king.y + forward*step
+			if x < 0 || x > 7 || y < 0 || y > 7 {
+				continue
+			}
+			if game.placement[x][y].piece == Pawn && game.placement[x][y].color == color {
+				shield++
+				break
+			}
+		}
+	}
+	score.add(params.PawnShield, shield)
+
+	//enemy attacks on the king and the squares around it
+	var attacks int = 0
+	var pieces []Position = getPieces(game, flipColor(color))
+	for i := 0; i < len(pieces); i++ {
+		if game.placement[pieces[i].x][pieces[i].y].piece == 0 {
+			continue
+		}
+		for _, target := range attackedSquares(game, &pieces[i]) {
+			if abs(target.x-king.x) <= 1 && abs(target.y-king.y) <= 1 {
+				attacks++
+			}
+		}
+	}
+	score.add(params.KingAttack, attacks)
+}
+
+// attackedSquares returns every square the piece on p attacks, including
+// squares occupied by pieces of its own color.
+func attackedSquares(game *Game, p *Position) []Position {
+	var piece Piece = game.placement[p.x][p.y]
+	var squares []Position
+
+	var ray = func(dx, dy int, slide bool) {
+		for x, y := p.x+dx, p.y+dy; x >= 0 && x < 8 && y >= 0 && y < 8; x, y = x+dx, y+dy {
+			squares = append(squares, Position{x, y})
+			if !slide || game.placement[x][y].piece != 0 {
+				break
+			}
+		}
+	}
+
+	switch piece.piece {
+	case Pawn:
+		var forward int = -1
+		if piece.color == Black {
+			forward = 1
+		}
+		ray(-1, forward, false)
+		ray(1, forward, false)
+
+	case Knight:
+		for _, offset := range [8][2]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}} {
+			ray(offset[0], offset[1], false)
+		}
+
+	case Bishop, Rook, Queen, King:
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				if dx == 0 && dy == 0 {
+					continue
+				}
+				var diagonal bool = dx != 0 && dy != 0
+				if (piece.piece == Bishop && !diagonal) || (piece.piece == Rook && diagonal) {
+					continue
+				}
+				ray(dx, dy, piece.piece != King)
+			}
+		}
+	}
+
+	return squares
+}
+
+// attackers returns the pieces of color that attack square.
+func attackers(game *Game, square Position, color PieceColor) []Position {
+	var result []Position
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == 0 || game.placement[x][y].color != color {
+				continue
+			}
+			var p Position = Position{x, y}
+			for _, attacked := range attackedSquares(game, &p) {
+				if attacked == square {
+					result = append(result, p)
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// GameSession is a game from its initial position: the moves played, the
+// position and its key after every ply, and the moves taken back, for
+// redo. Unlike a single fen it knows enough to judge repetitions.
+type GameSession struct {
+	start     Game
+	moves     []Move
+	positions []Game   //positions[i] is the position after i plies
+	keys      []uint64 //keys[i] is the Polyglot key of positions[i]
+	undone    []Move   //moves taken back, the most recent last
+}
+
+func newGameSession(start Game) *GameSession {
+	return &GameSession{start: start, positions: []Game{start}, keys: []uint64{polyglotKey(&start)}}
+}
+
+// parseGameSession reads "startpos" or a fen, optionally preceded by "fen",
+// followed by "moves" and the moves played from there, in coordinate
+// notation or SAN, like the UCI position command.
+func parseGameSession(text string) (*GameSession, error) {
+	var fields []string = strings.Fields(text)
+	if len(fields) > 0 && fields[0] == "fen" {
+		fields = fields[1:]
+	}
+
+	var end int = len(fields)
+	for i, field := range fields {
+		if field == "moves" {
+			end = i
+			break
+		}
+	}
+
+	var fen string = strings.Join(fields[:end], " ")
+	if fen == "startpos" {
+		fen = initialFen
+	}
+
+	start, err := loadFen(&fen)
+	if err != nil {
+		return nil, err
+	}
+
+	var g *GameSession = newGameSession(start)
+	for _, text := range fields[min(end+1, len(fields)):] {
+		move, err := parseMove(g.current(), text)
+		if err != nil {
+			return nil, err
+		}
+		g.play(move)
+	}
+
+	return g, nil
+}
+
+func (g *GameSession) current() *Game {
+	return &g.positions[len(g.positions)-1]
+}
+
+// play makes a legal move. The moves taken back before are forgotten.
+func (g *GameSession) play(move Move) {
+	var next Game = makeMove(*g.current(), move)
+	g.moves = append(g.moves, move)
+	g.positions = append(g.positions, next)
+	g.keys = append(g.keys, polyglotKey(&next))
+	g.undone = nil
+}
+
+// undo takes back the last move, if there is one.
+func (g *GameSession) undo() bool {
+	if len(g.moves) == 0 {
+		return false
+	}
+
+	g.undone = append(g.undone, g.moves[len(g.moves)-1])
+	g.moves = g.moves[:len(g.moves)-1]
+	g.positions = g.positions[:len(g.positions)-1]
+	g.keys = g.keys[:len(g.keys)-1]
+	return true
+}
+
+// redo plays the last move taken back again, if there is one.
+func (g *GameSession) redo() bool {
+	if len(g.undone) == 0 {
+		return false
+	}
+
+	var undone []Move = g.undone[:len(g.undone)-1]
+	g.play(g.undone[len(g.undone)-1])
+	g.undone = undone
+	return true
+}
+
+// clone copies the session, e.g. for a search that runs while the game goes
+// on.
+func (g *GameSession) clone() *GameSession {
+	return &GameSession{
+		start:     g.start,
+		moves:     append([]Move(nil), g.moves...),
+		positions: append([]Game(nil), g.positions...),
+		keys:      append([]uint64(nil), g.keys...),
+		undone:    append([]Move(nil), g.undone...),
+	}
+}
+
+// history returns the keys of the positions before the current one, for the
+// repetition detection of a search.
+func (g *GameSession) history() []uint64 {
+	return append(make([]uint64, 0, len(g.keys)+maxSearchDepth), g.keys[:len(g.keys)-1]...)
+}
+
+// repetitions counts how often the current position has occurred, itself
+// included. Only the positions since the last capture or pawn move can
+// repeat.
+func (g *GameSession) repetitions() int {
+	var last int = len(g.keys) - 1
+	var reversible, _ = strconv.Atoi(g.current().halfMove)
+	var count int = 1
+	for i := last - 2; i >= max(last-reversible, 0); i -= 2 {
+		if g.keys[i] == g.keys[last] {
+			count++
+		}
+	}
+	return count
+}
+
+// status is gameStatus, with "threefoldRepetition" once the position has
+// occurred three times.
+func (g *GameSession) status() string {
+	var status string = gameStatus(g.current())
+	if (status == "ongoing" || status == "check") && g.repetitions() >= 3 {
+		return "threefoldRepetition"
+	}
+	return status
+}
+
+// statusAfter is the status once move is played.
+func (g *GameSession) statusAfter(move Move) string {
+	var undone []Move = g.undone
+	g.play(move)
+	var status string = g.status()
+	g.undo()
+	g.undone = undone
+	return status
+}
+
+type gameSessionJson struct {
+	Start  string   `json:"start"`  //fen of the initial position
+	Moves  []string `json:"moves"`  //UCI notation
+	Redo   []string `json:"redo"`   //moves taken back, the next one to redo first
+	Fen    string   `json:"fen"`    //the current position, informational
+	Status string   `json:"status"` //informational
+}
+
+func (g *GameSession) MarshalJSON() ([]byte, error) {
+	var data gameSessionJson = gameSessionJson{
+		Start:  toFen(&g.start),
+		Moves:  []string{},
+		Redo:   []string{},
+		Fen:    toFen(g.current()),
+		Status: g.status(),
+	}
+	for _, move := range g.moves {
+		data.Moves = append(data.Moves, moveToUci(move))
+	}
+	for i := len(g.undone) - 1; i >= 0; i-- {
+		data.Redo = append(data.Redo, moveToUci(g.undone[i]))
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON replays the moves, and those to redo, so that only legal
+// games are read.
+func (g *GameSession) UnmarshalJSON(data []byte) error {
+	var parsed gameSessionJson
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if parsed.Start == "" {
+		return errors.New("game session without start position")
+	}
+
+	start, err := loadFen(&parsed.Start)
+	if err != nil {
+		return err
+	}
+
+	var result *GameSession = newGameSession(start)
+	for _, text := range append(parsed.Moves, parsed.Redo...) {
+		move, err := parseUciMove(result.current(), text)
+		if err != nil {
+			return err
+		}
+		result.play(move)
+	}
+	for range parsed.Redo {
+		result.undo()
+	}
+
+	*g = *result
+	return nil
+}
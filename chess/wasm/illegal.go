@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Why a move is not legal, in words a beginner understands. The reasons
+// are found the way the move generator decides: a move that is not
+// pseudo-legal breaks the piece's rules, a pseudo-legal one that is not
+// legal leaves the king in check.
+
+const (
+	reasonNoPiece              = "noPiece"
+	reasonNotYourTurn          = "notYourTurn"
+	reasonOwnPiece             = "ownPiece"    //the target square is taken by a piece of the same color
+	reasonInvalidMove          = "invalidMove" //the piece does not move like that
+	reasonBlocked              = "blocked"     //another piece is in the way
+	reasonPawnCapture          = "pawnCapture" //pawns move diagonally only to capture
+	reasonNoCastlingRights     = "noCastlingRights"
+	reasonCastlingBlocked      = "castlingBlocked"
+	reasonCastlingInCheck      = "castlingInCheck"
+	reasonCastlingThroughCheck = "castlingThroughCheck"
+	reasonInCheck              = "inCheck"       //the move does not get the king out of check
+	reasonPinned               = "pinned"        //the move exposes the king
+	reasonKingIntoCheck        = "kingIntoCheck" //the king moves onto an attacked square
+)
+
+type moveCheck struct {
+	Legal   bool   `json:"legal"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	Square  string `json:"square,omitempty"` //the piece in the way or giving check
+	Piece   string `json:"piece,omitempty"`  //its letter, upper case for white
+}
+
+func pieceName(piece PieceType) string {
+	switch piece {
+	case Pawn:
+		return "pawn"
+	case Knight:
+		return "knight"
+	case Bishop:
+		return "bishop"
+	case Rook:
+		return "rook"
+	case Queen:
+		return "queen"
+	case King:
+		return "king"
+	}
+	return ""
+}
+
+// pieceCode is the fen letter of a piece, upper case for white.
+func pieceCode(piece Piece) string {
+	if piece.color == White {
+		return strings.ToUpper(pieceLetter(piece.piece))
+	}
+	return pieceLetter(piece.piece)
+}
+
+// illegal builds the answer for a reason, naming the piece on square if
+// there is one.
+func illegal(game *Game, reason string, message string, square *Position) moveCheck {
+	var result moveCheck = moveCheck{Reason: reason, Message: message}
+	if square != nil {
+		var piece Piece = game.placement[square.x][square.y]
+		result.Square = squareName(*square)
+		if piece.piece != 0 {
+			result.Piece = pieceCode(piece)
+			result.Message += " (" + pieceName(piece.piece) + " on " + result.Square + ")"
+		}
+	}
+	return result
+}
+
+// checkMove tells whether moving the piece on from to to is legal and, if
+// not, why.
+func checkMove(game *Game, from, to Position) moveCheck {
+	var piece Piece = game.placement[from.x][from.y]
+	var target Piece = game.placement[to.x][to.y]
+
+	if piece.piece == 0 {
+		return illegal(game, reasonNoPiece, "There is no piece on "+squareName(from)+".", nil)
+	}
+	if piece.color != game.color {
+		return illegal(game, reasonNotYourTurn, "It is not your turn, that piece belongs to the other side.", nil)
+	}
+	if from == to {
+		return illegal(game, reasonInvalidMove, "The piece has to move to another square.", nil)
+	}
+	if target.piece != 0 && target.color == piece.color {
+		return illegal(game, reasonOwnPiece, "You cannot capture your own piece.", &to)
+	}
+
+	if piece.piece == King && abs(to.x-from.x) == 2 && to.y == from.y {
+		return checkCastling(game, from, to)
+	}
+
+	var move Move
+	for _, m := range pseudoLegalMoves(game, game.color) {
+		if m.p0 == from && m.p1 == to {
+			move = m
+			break
+		}
+	}
+	if move == (Move{}) {
+		return checkPieceRules(game, piece, from, to)
+	}
+
+	var next Game = makeMove(*game, move)
+	if !inCheck(next, game.color) {
+		return moveCheck{Legal: true}
+	}
+
+	var checkers []Position = attackers(&next, findKing(&next, game.color), flipColor(game.color))
+	var checker *Position
+	if len(checkers) > 0 {
+		checker = &checkers[0]
+	}
+
+	if piece.piece == King {
+		return illegal(&next, reasonKingIntoCheck, "The king cannot move onto a square that is attacked.", checker)
+	}
+	if inCheck(*game, game.color) {
+		return illegal(&next, reasonInCheck, "Your king is in check, the move has to get it out of check.", checker)
+	}
+	return illegal(&next, reasonPinned, "The "+pieceName(piece.piece)+" is pinned, moving it would leave your king in check.", checker)
+}
+
+// checkPieceRules explains a move that is not pseudo-legal: either the
+// piece does not move like that, or something is in the way.
+func checkPieceRules(game *Game, piece Piece, from, to Position) moveCheck {
+	var dx, dy int = to.x - from.x, to.y - from.y
+	var invalid moveCheck = illegal(game, reasonInvalidMove, "The "+pieceName(piece.piece)+" does not move like that.", nil)
+
+	switch piece.piece {
+	case Pawn:
+		var forward, startRank int = -1, 6
+		if piece.color == Black {
+			forward, startRank = 1, 1
+		}
+
+		if dx == 0 && dy == forward {
+			return illegal(game, reasonBlocked, "Pawns cannot capture straight ahead, the square is taken.", &to)
+		}
+		if dx == 0 && dy == 2*forward {
+			if from.y != startRank {
+				return illegal(game, reasonInvalidMove, "A pawn can only move two squares from its starting square.", nil)
+			}
+			var between Position = Position{from.x, from.y + forward}
+			if game.placement[between.x][between.y].piece != 0 {
+				return illegal(game, reasonBlocked, "The pawn cannot jump over a piece.", &between)
+			}
+			return illegal(game, reasonBlocked, "Pawns cannot capture straight ahead, the square is taken.", &to)
+		}
+		if abs(dx) == 1 && dy == forward {
+			return illegal(game, reasonPawnCapture, "Pawns only move diagonally when they capture.", nil)
+		}
+		return illegal(game, reasonInvalidMove, "Pawns move forward one square, two from their starting square, and capture diagonally.", nil)
+
+	case Knight, King:
+		return invalid
+
+	case Bishop, Rook, Queen:
+		var straight bool = dx == 0 || dy == 0
+		var diagonal bool = abs(dx) == abs(dy)
+		if (piece.piece == Bishop && !diagonal) || (piece.piece == Rook && !straight) || (!straight && !diagonal) {
+			return invalid
+		}
+
+		var stepX, stepY int = sign(dx), sign(dy)
+		for p := (Position{from.x + stepX, from.y + stepY}); p != to; p = (Position{p.x + stepX, p.y + stepY}) {
+			if game.placement[p.x][p.y].piece != 0 {
+				return illegal(game, reasonBlocked, "The "+pieceName(piece.piece)+" cannot jump over other pieces.", &p)
+			}
+		}
+	}
+
+	return invalid
+}
+
+// checkCastling explains a king move of two squares.
+func checkCastling(game *Game, from, to Position) moveCheck {
+	var kingside bool = to.x > from.x
+	var home int = 7
+	var right string = "Q"
+	if kingside {
+		right = "K"
+	}
+	if game.color == Black {
+		home = 0
+		right = strings.ToLower(right)
+	}
+
+	var rook Position = Position{0, home}
+	if kingside {
+		rook = Position{7, home}
+	}
+
+	if from != (Position{4, home}) || !strings.Contains(game.castling, right) ||
+		game.placement[rook.x][rook.y] != (Piece{Rook, game.color}) {
+		return illegal(game, reasonNoCastlingRights, "You cannot castle on this side any more, the king or the rook has moved.", nil)
+	}
+
+	for x := min(from.x, rook.x) + 1; x < max(from.x, rook.x); x++ {
+		if game.placement[x][home].piece != 0 {
+			var p Position = Position{x, home}
+			return illegal(game, reasonCastlingBlocked, "All squares between the king and the rook have to be empty to castle.", &p)
+		}
+	}
+
+	var enemy PieceColor = flipColor(game.color)
+	if checkers := attackers(game, from, enemy); len(checkers) > 0 {
+		return illegal(game, reasonCastlingInCheck, "You cannot castle while your king is in check.", &checkers[0])
+	}
+
+	var through Position = Position{(from.x + to.x) / 2, home}
+	var passed Game = makeMove(*game, Move{p0: from, p1: through})
+	if checkers := attackers(&passed, through, enemy); len(checkers) > 0 {
+		return illegal(&passed, reasonCastlingThroughCheck, "The king cannot castle through a square that is attacked.", &checkers[0])
+	}
+
+	var castled Game = makeMove(*game, Move{p0: from, p1: to})
+	if checkers := attackers(&castled, to, enemy); len(checkers) > 0 {
+		return illegal(&castled, reasonKingIntoCheck, "The king cannot move onto a square that is attacked.", &checkers[0])
+	}
+
+	return moveCheck{Legal: true}
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkMoveJson is checkMove for a fen and square names, as JSON.
+func checkMoveJson(fen string, from string, to string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	p0, ok := parseSquare(from)
+	p1, ok2 := parseSquare(to)
+	if !ok || !ok2 {
+		return "", errors.New("invalid square " + from + " or " + to)
+	}
+
+	data, err := json.Marshal(checkMove(&game, p0, p1))
+	return string(data), err
+}
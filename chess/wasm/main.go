@@ -1,42 +1,706 @@
+//go:build js && wasm
+
 package main
 
 import (
+	"encoding/json"
+	"sync/atomic"
 	"syscall/js"
+	"time"
 )
 
 func main() {
 	c := make(chan struct{}, 0)
 	js.Global().Set("ChessAi", js.FuncOf(calc))
+	js.Global().Set("ChessSearch", js.FuncOf(startSearch))
+	js.Global().Set("ChessNewEngine", js.FuncOf(newEngine))
+	js.Global().Set("ChessLoadParams", js.FuncOf(loadParams))
+	js.Global().Set("ChessLoadWdl", js.FuncOf(loadWdl))
+	js.Global().Set("ChessExplain", js.FuncOf(explainPosition))
+	js.Global().Set("ChessLoadTablebase", js.FuncOf(loadTablebase))
+	js.Global().Set("ChessLoadBook", js.FuncOf(loadBook))
+	js.Global().Set("ChessAnalyze", js.FuncOf(analyzePosition))
+	js.Global().Set("ChessSetSkill", js.FuncOf(setSkill))
+	js.Global().Set("ChessSetElo", js.FuncOf(setElo))
+	js.Global().Set("ChessLegalMoves", js.FuncOf(getLegalMoves))
+	js.Global().Set("ChessMakeMove", js.FuncOf(playMove))
+	js.Global().Set("ChessInCheck", js.FuncOf(isInCheck))
+	js.Global().Set("ChessStatus", js.FuncOf(getStatus))
+	js.Global().Set("ChessSan", js.FuncOf(getSan))
+	js.Global().Set("ChessExplainMove", js.FuncOf(explainMove))
+	js.Global().Set("ChessThreats", js.FuncOf(getThreats))
+	js.Global().Set("ChessTactics", js.FuncOf(getTactics))
+	js.Global().Set("ChessComment", js.FuncOf(getComment))
+	js.Global().Set("ChessAnnotate", js.FuncOf(annotate))
+	js.Global().Set("ChessAccuracy", js.FuncOf(getAccuracy))
 	<-c
 }
 
+// calc returns the engine's move for a fen as a JSON string: move (UCI and
+// SAN), score or mate, wdl (the win, draw and loss chances of the score in
+// per mille), depth, pv, nodes, time, the game status after the move and
+// its flags as for getLegalMoves, or an error field. The fen may be
+// followed by "moves" and the moves played since, like the UCI position
+// command, so that repetitions are seen. The book is consulted unless the
+// third argument is false.
 func calc(this js.Value, i []js.Value) interface{} {
-	var fen string = i[0].String()
-	//var depth string = i[1].String()
+	var position string = jsArg(i, 0)
+	//var depth string = jsArg(i, 1)
 
-	game, err := loadFen(&fen)
+	game, err := parseGameSession(position)
 
 	if err != nil {
-		return err.Error()
+		return engineResult{Pv: []string{}, Error: err.Error()}.String()
 	}
 
 	//printPosition(&game)
 
+	var useBook bool = len(i) < 3 || i[2].IsUndefined() || i[2].Truthy()
+
 	//var move Move = randomMove(&game)
-	var move, _ = calculate(&game, 3)
+	return engineMove(game, useBook).String()
+}
+
+// startSearch searches a fen, optionally followed by moves as for calc,
+// without blocking the page and returns a Promise of the same JSON result as
+// calc. Options, all optional:
+//
+//	depth      maximum depth, 3 by default, unlimited with movetime or infinite
+//	movetime   milliseconds to search
+//	infinite   search until stop() is called
+//	lines      number of principal variations reported to onProgress
+//	skill      playing strength from 1 to 20, 20 (full strength) by default
+//	elo        playing strength as a rating from 600 to 2500, see skill
+//	book       false to skip the opening book
+//	bookBest   true to always play the book's highest weighted move
+//	yield      false to run without pausing, e.g. inside a web worker
+//	verbosity  0 for no callbacks, 1 for onProgress (the default), 2 for
+//	           onInfo as well
+//	onProgress called with a JSON string after every completed depth: the
+//	           lines and the telemetry of depth, seldepth, nodes, nps, time,
+//	           hashfull, ttHits, cutoffs and firstMoveCutoffs
+//	onInfo     called with the telemetry as a JSON string, with currMove
+//	           and currMoveNumber, whenever the search turns to the next
+//	           root move
+//
+// The Promise has a stop() method that ends the search and returns the best
+// result found so far; once the search is over it returns the result, which
+// is also kept in the Promise's result property. The search yields to the
+// browser every few milliseconds, so the page stays responsive and stop()
+// can get through.
+func startSearch(this js.Value, i []js.Value) interface{} {
+	var options js.Value = js.Undefined()
+	if len(i) > 1 && i[1].Type() == js.TypeObject {
+		options = i[1]
+	}
+
+	game, err := parseGameSession(jsArg(i, 0))
+	if err != nil {
+		var result string = engineResult{Pv: []string{}, Error: err.Error()}.String()
+		var promise js.Value = js.Global().Get("Promise").Call("resolve", result)
+		promise.Set("stop", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return result
+		}))
+		return promise
+	}
+
+	//a session of its own for the settings, without a transposition table,
+	//with the defaults of a new engine rather than those of ChessAi
+	var e *session = &session{skill: maxSkill, book: true, lines: 1}
+	for _, name := range []string{"skill", "elo", "book", "bookBest", "lines"} {
+		if value := jsOption(options, name); !value.IsUndefined() {
+			e.setOption(name, js.Global().Get("String").Invoke(value).String())
+		}
+	}
 
-	return moveToString(move)
+	return searchPromise(e, game, options, &atomic.Bool{})
 }
 
-/*
-func main() {
-	var initialPosition string = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
-	game, err := loadFen(&initialPosition)
+// jsArg is argument n as a string, empty if it is missing, undefined or
+// null. Indexing a missing argument would panic, and a panic ends the Go
+// program for every window of the page.
+func jsArg(args []js.Value, n int) string {
+	if len(args) <= n || args[n].IsUndefined() || args[n].IsNull() {
+		return ""
+	}
+	return js.Global().Get("String").Invoke(args[n]).String()
+}
+
+func jsOption(options js.Value, name string) js.Value {
+	if options.Type() != js.TypeObject {
+		return js.Undefined()
+	}
+	return options.Get(name)
+}
+
+// searchPromise runs a search of the current position of a game in the
+// background, with the settings of a session. See startSearch for the
+// Promise and the options. The game must not change during the search.
+func searchPromise(e *session, g *GameSession, options js.Value, stop *atomic.Bool) js.Value {
+	var option = func(name string) js.Value {
+		return jsOption(options, name)
+	}
+
+	var start time.Time = time.Now()
+	var s *search = &search{stop: stop, yield: func() { time.Sleep(time.Millisecond) }, lastYield: start, start: start}
+	var depth int = 3
+	var level int = verbosity
+
+	if option("yield").Type() == js.TypeBoolean && !option("yield").Bool() {
+		s.yield = nil
+	}
+	if option("movetime").Type() == js.TypeNumber {
+		s.deadline = start.Add(time.Duration(option("movetime").Int()) * time.Millisecond)
+		depth = maxSearchDepth
+	}
+	if option("infinite").Truthy() {
+		depth = maxSearchDepth
+	}
+	if option("depth").Type() == js.TypeNumber {
+		depth = min(max(option("depth").Int(), 1), maxSearchDepth)
+	}
+	if option("verbosity").Type() == js.TypeNumber {
+		level = option("verbosity").Int()
+	}
+	var infinite bool = option("infinite").Truthy()
+	var progress js.Value = option("onProgress")
+	if level < verbosityIterations {
+		progress = js.Undefined()
+	}
+	if onInfo := option("onInfo"); level >= verbosityMoves && onInfo.Type() == js.TypeFunction {
+		s.rootMove = func(depth int, move Move, number int) {
+			var info searchInfo = s.info(depth)
+			info.CurrMove = moveToUci(move)
+			info.CurrMoveNumber = number
+			onInfo.Invoke(info.String())
+		}
+	}
+
+	var best engineResult = engineResult{Pv: []string{}}
+	var done bool = false
+	var promise js.Value
+	var stopFunc js.Func
+	var ready chan struct{} = make(chan struct{}) //closed once stop is set on the promise
+
+	var executor js.Func = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var resolve js.Value = args[0]
+
+		go func() {
+			var result engineResult = e.think(s, g, depth, start, func(result engineResult, lines []searchLine) {
+				best = result
+				if progress.Type() == js.TypeFunction {
+					progress.Invoke(searchProgress{s.info(result.Depth), lines}.String())
+				}
+			})
+			best = result
+
+			//an infinite search waits for stop()
+			for infinite && !stop.Load() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			//from now on stop only returns the result, without calling into Go
+			done = true
+			<-ready
+			promise.Set("result", best.String())
+			promise.Set("stop", js.Global().Get("Function").New("return this.result"))
+			stopFunc.Release()
+			resolve.Invoke(best.String())
+		}()
+
+		return nil
+	})
+
+	promise = js.Global().Get("Promise").New(executor)
+	executor.Release()
+
+	stopFunc = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		stop.Store(true)
+		if done || best.Move != "" {
+			return best.String()
+		}
+
+		//stopped before the first depth completed
+		var game *Game = g.current()
+		var line searchLine
+		if moves := legalMoves(game, game.color); len(moves) > 0 {
+			line = newSearchLine(game, 0, moves[:1])
+		}
+		return newEngineResult(g, line, 0, s.nodes, start).String()
+	})
+	promise.Set("stop", stopFunc)
+	close(ready)
+
+	return promise
+}
+
+// newEngine creates an engine with a game and settings of its own, for
+// example one for every chess window. The returned object has the methods
+//
+//	position(fen, moves)   set up a fen, optionally followed by an array of
+//	                       moves; returns an empty string or an error
+//	move(move)             play a move in UCI notation or SAN; returns the
+//	                       same JSON as ChessMakeMove
+//	undo()                 take back the last move; returns false if there
+//	                       is none
+//	redo()                 play the last move taken back again; returns
+//	                       false if there is none
+//	newGame()              start over and clear the transposition table
+//	fen()                  the current position
+//	status()               the status of the game, see ChessStatus, or
+//	                       "threefoldRepetition"
+//	save()                 the game as JSON: start, moves, redo, fen and
+//	                       status
+//	load(json)             continue a saved game; returns an empty string
+//	                       or an error
+//	setOption(name, value) skill, elo, book, bookBest, lines or hash (MB);
+//	                       returns an empty string or an error
+//	go(options)            search the current position, see ChessSearch
+//	stop()                 stop the running search; returns its best result
+//	dispose()              stop and free the engine
+//
+// Changing the game stops a running search. Moves are not played by go, the
+// chosen move has to be passed to move like any other.
+func newEngine(this js.Value, i []js.Value) interface{} {
+	var e *session = newSession()
+	var object js.Value = js.Global().Get("Object").New()
+	var funcs []js.Func
+	var running js.Value = js.Undefined()
+
+	var method = func(name string, fn func(args []js.Value) interface{}) {
+		var f js.Func = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return fn(args)
+		})
+		funcs = append(funcs, f)
+		object.Set(name, f)
+	}
+	var halt = func() interface{} {
+		if running.IsUndefined() {
+			return ""
+		}
+		var result js.Value = running.Call("stop")
+		running = js.Undefined()
+		return result
+	}
+	method("position", func(args []js.Value) interface{} {
+		halt()
+		var moves []string
+		if len(args) > 1 && args[1].Type() == js.TypeObject {
+			for n := 0; n < args[1].Length(); n++ {
+				moves = append(moves, args[1].Index(n).String())
+			}
+		}
+		if err := e.setPosition(jsArg(args, 0), moves); err != nil {
+			return err.Error()
+		}
+		return ""
+	})
+	method("move", func(args []js.Value) interface{} {
+		halt()
+		result, err := e.play(jsArg(args, 0))
+		if err != nil {
+			return errorJson(err)
+		}
+		data, _ := json.Marshal(result)
+		return string(data)
+	})
+	method("undo", func(args []js.Value) interface{} {
+		halt()
+		return e.game.undo()
+	})
+	method("redo", func(args []js.Value) interface{} {
+		halt()
+		return e.game.redo()
+	})
+	method("newGame", func(args []js.Value) interface{} {
+		halt()
+		e.newGame()
+		return nil
+	})
+	method("fen", func(args []js.Value) interface{} {
+		return toFen(e.game.current())
+	})
+	method("status", func(args []js.Value) interface{} {
+		return e.game.status()
+	})
+	method("save", func(args []js.Value) interface{} {
+		data, _ := json.Marshal(e.game)
+		return string(data)
+	})
+	method("load", func(args []js.Value) interface{} {
+		halt()
+		var game *GameSession = &GameSession{}
+		if err := json.Unmarshal([]byte(jsArg(args, 0)), game); err != nil {
+			return err.Error()
+		}
+		e.game = game
+		return ""
+	})
+	method("setOption", func(args []js.Value) interface{} {
+		if err := e.setOption(jsArg(args, 0), jsArg(args, 1)); err != nil {
+			return err.Error()
+		}
+		return ""
+	})
+	method("go", func(args []js.Value) interface{} {
+		halt()
+		var options js.Value = js.Undefined()
+		if len(args) > 0 {
+			options = args[0]
+		}
+		running = searchPromise(e, e.game.clone(), options, &atomic.Bool{})
+		return running
+	})
+	method("stop", func(args []js.Value) interface{} {
+		return halt()
+	})
+	method("dispose", func(args []js.Value) interface{} {
+		halt()
+		for _, f := range funcs {
+			f.Release()
+		}
+		e.table = nil
+		return nil
+	})
+
+	return object
+}
+
+// loadParams replaces the evaluation parameters with a JSON document, as
+// written by the native tune command. Returns an empty string on success.
+func loadParams(this js.Value, i []js.Value) interface{} {
+	p, err := parseParams([]byte(jsArg(i, 0)))
+
+	if err != nil {
+		return err.Error()
+	}
+
+	params = p
+	return ""
+}
+
+// loadWdl replaces the model behind the win/draw/loss probabilities with a
+// JSON document, as written by the native wdlfit command. Returns an empty
+// string on success.
+func loadWdl(this js.Value, i []js.Value) interface{} {
+	m, err := parseWdl([]byte(jsArg(i, 0)))
+
+	if err != nil {
+		return err.Error()
+	}
+
+	wdlParams = m
+	return ""
+}
+
+// explainPosition returns the evaluation breakdown of a fen as a JSON
+// string, or an object with an error field.
+func explainPosition(this js.Value, i []js.Value) interface{} {
+	data, err := explain(jsArg(i, 0))
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// analyzePosition returns the best moves of a fen with their scores and
+// principal variations as a JSON string, or an object with an error field.
+// Arguments: fen, depth (default 3), number of lines (default 3).
+func analyzePosition(this js.Value, i []js.Value) interface{} {
+	var depth, count int = 3, 3
+	if len(i) > 1 && i[1].Type() == js.TypeNumber {
+		depth = max(i[1].Int(), 1)
+	}
+	if len(i) > 2 && i[2].Type() == js.TypeNumber {
+		count = max(i[2].Int(), 1)
+	}
+
+	data, err := analyze(jsArg(i, 0), depth, count)
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// loadTablebase registers a tablebase file passed as a Uint8Array. It is
+// only decompressed when the search first reaches its material, so tables
+// can be fetched and handed over as soon as they are available. Returns an
+// empty string on success.
+func loadTablebase(this js.Value, i []js.Value) interface{} {
+	if len(i) == 0 || i[0].Type() != js.TypeObject {
+		return "expected a Uint8Array"
+	}
+	var data []byte = make([]byte, i[0].Get("length").Int())
+	js.CopyBytesToGo(data, i[0])
+
+	tb, err := parseTablebase(data)
+	if err != nil {
+		return err.Error()
+	}
+
+	registerTablebase(tb)
+	return ""
+}
+
+// setSkill sets the playing strength of ChessAi from 1 to 20, 20 being
+// full strength. Engines and ChessSearch have their own setting. Returns
+// the level in use.
+func setSkill(this js.Value, i []js.Value) interface{} {
+	if len(i) > 0 && i[0].Type() == js.TypeNumber {
+		skill = min(max(i[0].Int(), 1), maxSkill)
+	}
+	return skill
+}
+
+// setElo sets the playing strength of ChessAi to roughly a rating between
+// 600 and 2500. Returns the skill level in use.
+func setElo(this js.Value, i []js.Value) interface{} {
+	if len(i) > 0 && i[0].Type() == js.TypeNumber {
+		skill = skillForElo(i[0].Int())
+	}
+	return skill
+}
+
+// loadBook replaces the opening book of all engines with a Polyglot book
+// passed as a Uint8Array. With a second argument of true ChessAi always
+// plays the book's best move instead of a weighted random one. Returns an
+// empty string on success.
+func loadBook(this js.Value, i []js.Value) interface{} {
+	if len(i) == 0 || i[0].Type() != js.TypeObject {
+		return "expected a Uint8Array"
+	}
+	var data []byte = make([]byte, i[0].Get("length").Int())
+	js.CopyBytesToGo(data, i[0])
+
+	b, err := parseBook(data)
+	if err != nil {
+		return err.Error()
+	}
+
+	book = b
+	bookBestMove = len(i) > 1 && i[1].Truthy()
+	return ""
+}
+
+// getLegalMoves returns the legal moves of a fen as a JSON array of move
+// (UCI), san, from, to and what the move does: capture, enPassant, castle,
+// rook, promotion, captured, capturedSquare, check and checkmate. With a
+// square as second argument only the moves of the piece there are listed.
+func getLegalMoves(this js.Value, i []js.Value) interface{} {
+	var square string = ""
+	if len(i) > 1 && i[1].Type() == js.TypeString {
+		square = jsArg(i, 1)
+	}
+
+	data, err := legalMovesJson(jsArg(i, 0), square)
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// playMove validates a move, in UCI notation or SAN, and returns fen, move,
+// san, the game status after it and the same flags as getLegalMoves as a
+// JSON string, or an object with an error field if the move is illegal.
+func playMove(this js.Value, i []js.Value) interface{} {
+	data, err := applyMove(jsArg(i, 0), jsArg(i, 1))
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// isInCheck tells whether the side to move of a fen is in check.
+func isInCheck(this js.Value, i []js.Value) interface{} {
+	var fen string = jsArg(i, 0)
+	game, err := loadFen(&fen)
+
+	if err != nil {
+		return false
+	}
+
+	return inCheck(game, game.color)
+}
+
+// getStatus returns the status of a fen: "ongoing", "check", "checkmate",
+// "stalemate", "insufficientMaterial" or "fiftyMoveRule", or an empty
+// string for an invalid fen.
+func getStatus(this js.Value, i []js.Value) interface{} {
+	var fen string = jsArg(i, 0)
+	game, err := loadFen(&fen)
 
 	if err != nil {
-		println(err.Error())
+		return ""
 	}
 
-	calculate(&game, Move{}, 5)
+	return gameStatus(&game)
+}
+
+// getSan writes a legal move of a fen, given in UCI notation, in SAN.
+// Returns an empty string if the move is illegal.
+func getSan(this js.Value, i []js.Value) interface{} {
+	san, err := sanOf(jsArg(i, 0), jsArg(i, 1))
+
+	if err != nil {
+		return ""
+	}
+
+	return san
+}
+
+// explainMove tells whether moving from one square to another is legal in a
+// fen and, if not, why, as JSON: legal, reason, a message for the player
+// and the square and letter of the piece in the way or giving check, if
+// any. Errors are returned in an error field.
+func explainMove(this js.Value, i []js.Value) interface{} {
+	data, err := checkMoveJson(jsArg(i, 0), jsArg(i, 1), jsArg(i, 2))
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// getThreats returns the threats of a fen as JSON: for every square how
+// many white and black pieces attack it, the hanging pieces with the
+// material they lose and the pinned pieces. With a move, in UCI notation or
+// SAN, as second argument the threats are those after the move, to warn
+// before it is played. Errors are returned in an error field.
+func getThreats(this js.Value, i []js.Value) interface{} {
+	var move string = ""
+	if len(i) > 1 && i[1].Type() == js.TypeString {
+		move = jsArg(i, 1)
+	}
+
+	data, err := threatsJson(jsArg(i, 0), move)
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// getTactics labels the tactics of a fen as JSON. With a move, in UCI
+// notation or SAN, as second argument these are the motifs the move
+// creates (fork, pins, skewer, discovered attack or check, double check,
+// removal of the defender, checkmate and its pattern), with the material
+// it wins according to a short search and whether that makes it sound.
+// Without a move they are the forks, pins and skewers on the board, and a
+// double check or mate of the side to move. Errors are returned in an error
+// field.
+func getTactics(this js.Value, i []js.Value) interface{} {
+	var move string = ""
+	if len(i) > 1 && i[1].Type() == js.TypeString {
+		move = jsArg(i, 1)
+	}
+
+	data, err := tacticsJson(jsArg(i, 0), move)
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// getComment describes a move in a few English sentences, as JSON with the
+// move, its SAN, the comment, its sentences, the tactics and the gain as
+// for getTactics. The position is a fen, optionally followed by moves as
+// for calc; the move, in UCI notation or SAN, is played from there. Without
+// a move, an array with a comment for every move of the position is
+// returned. Errors are returned in an error field.
+func getComment(this js.Value, i []js.Value) interface{} {
+	var move string = ""
+	if len(i) > 1 && i[1].Type() == js.TypeString {
+		move = jsArg(i, 1)
+	}
+
+	data, err := commentJson(jsArg(i, 0), move)
+
+	if err != nil {
+		return errorJson(err)
+	}
+
+	return data
+}
+
+// annotate analyzes every move of a PGN, or of a list of moves, in the
+// background and returns a Promise of a JSON string: the plies with their
+// evaluation, the best move, the centipawn loss, the class (best, good,
+// inaccuracy, mistake or blunder), the NAG, the accuracy and the phase, the
+// evaluation series for a graph, the annotated PGN and the reports of both
+// players as for getAccuracy, or an error field. Options, all optional:
+//
+//	nodes      nodes searched per position, 10000 by default
+//	depth      maximum depth per position
+//	yield      false to run without pausing, e.g. inside a web worker
+//	onProgress called with the positions searched and their total
+func annotate(this js.Value, i []js.Value) interface{} {
+	return analysisPromise(i, annotateJson)
+}
+
+// getAccuracy analyzes a game like annotate and returns a Promise of the
+// reports of both players as JSON: moves, average centipawn loss (acpl),
+// accuracy from 0 to 100, the number of moves of each class and the same
+// for the opening, middlegame and endgame, with the tags of the PGN.
+func getAccuracy(this js.Value, i []js.Value) interface{} {
+	return analysisPromise(i, accuracyJson)
+}
+
+// analysisPromise runs a game analysis in the background with the options
+// of annotate.
+func analysisPromise(i []js.Value, analyze func(text string, budget annotateBudget, progress func(done, total int), yield func()) (string, error)) js.Value {
+	var text string = jsArg(i, 0)
+	var options js.Value = js.Undefined()
+	if len(i) > 1 && i[1].Type() == js.TypeObject {
+		options = i[1]
+	}
+
+	var budget annotateBudget = defaultAnnotateBudget
+	if nodes := jsOption(options, "nodes"); nodes.Type() == js.TypeNumber {
+		budget.nodes = max(nodes.Int(), 1)
+	}
+	if depth := jsOption(options, "depth"); depth.Type() == js.TypeNumber {
+		budget.depth = min(max(depth.Int(), 1), maxSearchDepth)
+	}
+
+	var yield func() = func() { time.Sleep(time.Millisecond) }
+	if option := jsOption(options, "yield"); option.Type() == js.TypeBoolean && !option.Bool() {
+		yield = nil
+	}
+
+	var progress func(done, total int)
+	if onProgress := jsOption(options, "onProgress"); onProgress.Type() == js.TypeFunction {
+		progress = func(done, total int) {
+			onProgress.Invoke(done, total)
+		}
+	}
+
+	var executor js.Func = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var resolve js.Value = args[0]
+
+		go func() {
+			data, err := analyze(text, budget, progress, yield)
+			if err != nil {
+				data = errorJson(err)
+			}
+			resolve.Invoke(data)
+		}()
+
+		return nil
+	})
+
+	var promise js.Value = js.Global().Get("Promise").New(executor)
+	executor.Release()
+	return promise
 }
-*/
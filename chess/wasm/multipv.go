@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// searchLine is one candidate of a multi-PV search.
+type searchLine struct {
+	Move  string   `json:"move"`           //e.g. "e2e4"
+	San   string   `json:"san"`            //e.g. "e4"
+	Score int      `json:"score"`          //side to move's point of view
+	Mate  int      `json:"mate,omitempty"` //moves to mate, negative when getting mated
+	Pv    []string `json:"pv"`             //the line starting with the move
+	PvSan []string `json:"pvSan"`
+
+	move Move
+	pv   []Move
+}
+
+type analysis struct {
+	Fen   string       `json:"fen"`
+	Depth int          `json:"depth"`
+	Lines []searchLine `json:"lines"`
+}
+
+// multiPV finds the best count root moves, best first. Every line is a full
+// search of the root moves that are not already the first move of a better
+// line, so each score is exact rather than a bound.
+func multiPV(game *Game, depth int, count int) []searchLine {
+	var s search
+	return s.multiPV(game, depth, count)
+}
+
+// multiPV stops early when the search runs into its node limit; the lines
+// completed by then are returned.
+func (s *search) multiPV(game *Game, depth int, count int) []searchLine {
+	var lines []searchLine
+	var exclude []Move
+
+	for len(lines) < count {
+		move, score, pv := s.searchRoot(game, depth, exclude)
+		if move == (Move{}) || s.stopped {
+			break
+		}
+
+		lines = append(lines, newSearchLine(game, score, pv))
+		exclude = append(exclude, move)
+	}
+
+	return lines
+}
+
+func newSearchLine(game *Game, score int, pv []Move) searchLine {
+	var line searchLine = searchLine{
+		Move:  moveToUci(pv[0]),
+		San:   moveToSan(game, pv[0]),
+		Score: score,
+		Mate:  mateIn(score),
+		Pv:    []string{},
+		PvSan: []string{},
+		move:  pv[0],
+		pv:    pv,
+	}
+
+	var position Game = *game
+	for _, move := range pv {
+		line.Pv = append(line.Pv, moveToUci(move))
+		line.PvSan = append(line.PvSan, moveToSan(&position, move))
+		position = makeMove(position, move)
+	}
+
+	return line
+}
+
+// analyze runs a multi-PV search of a position and returns the lines as
+// JSON.
+func analyze(fen string, depth int, count int) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	var result analysis = analysis{Fen: fen, Depth: depth, Lines: multiPV(&game, depth, count)}
+	if result.Lines == nil {
+		result.Lines = []searchLine{}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,195 @@
+//go:build !js
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var commands map[string]func(args []string) error = map[string]func(args []string) error{
+	"uci":       uciCommand,
+	"xboard":    xboardCommand,
+	"move":      moveCommand,
+	"tune":      tuneCommand,
+	"explain":   explainCommand,
+	"analyze":   analyzeCommand,
+	"tbgen":     tbgenCommand,
+	"makebook":  makebookCommand,
+	"mergebook": mergebookCommand,
+	"accuracy":  accuracyCommand,
+	"wdlfit":    wdlfitCommand,
+}
+
+func main() {
+	var paramsPath *string = flag.String("params", "", "load evaluation parameters from a JSON file")
+	var wdlPath *string = flag.String("wdl", "", "load the win/draw/loss model from a JSON file")
+	var tablebaseDir *string = flag.String("tb", "", "load the endgame tablebases found in a directory")
+	var bookPath *string = flag.String("book", "", "load a Polyglot opening book")
+	var noBook *bool = flag.Bool("nobook", false, "do not consult the opening book")
+	var bestBookMove *bool = flag.Bool("bookbest", false, "always play the book's highest weighted move")
+	var level *int = flag.Int("level", maxSkill, "skill level from 1 to 20")
+	var elo *int = flag.Int("elo", 0, "play at roughly this rating (600-2500) instead of a skill level")
+	var verbose *int = flag.Int("verbosity", verbosityIterations, "search output: 0 only the result, 1 every depth, 2 every root move")
+	flag.Parse()
+
+	verbosity = min(max(*verbose, verbosityQuiet), verbosityMoves)
+
+	skill = min(max(*level, 1), maxSkill)
+	if *elo > 0 {
+		skill = skillForElo(*elo)
+	}
+
+	if *bookPath != "" {
+		data, err := os.ReadFile(*bookPath)
+		if err == nil {
+			book, err = parseBook(data)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	bookEnabled = !*noBook
+	bookBestMove = *bestBookMove
+
+	if *tablebaseDir != "" {
+		if err := loadTablebaseDir(*tablebaseDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *paramsPath != "" {
+		p, err := loadParamsFile(*paramsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		params = p
+	}
+
+	if *wdlPath != "" {
+		m, err := loadWdlFile(*wdlPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		wdlParams = m
+	}
+
+	if flag.NArg() == 0 { //GUIs start engines without arguments
+		if err := uciCommand(nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", flag.Arg(0))
+		os.Exit(2)
+	}
+
+	if err := command(flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// explainCommand prints the evaluation breakdown of the fen given as
+// arguments.
+func explainCommand(args []string) error {
+	data, err := explain(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(data)
+	return nil
+}
+
+// analyzeCommand prints the best moves of a fen with their principal
+// variations.
+func analyzeCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("analyze", flag.ExitOnError)
+	var depth *int = flags.Int("depth", 3, "search depth in plies")
+	var lines *int = flags.Int("lines", 3, "number of principal variations")
+	flags.Parse(args)
+
+	data, err := analyze(strings.Join(flags.Args(), " "), *depth, *lines)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(data)
+	return nil
+}
+
+// moveCommand prints the move the engine plays in the position given as
+// arguments, a fen or startpos optionally followed by "moves" and the moves
+// played since, the initial position by default.
+func moveCommand(args []string) error {
+	var position string = "startpos"
+	if len(args) > 0 {
+		position = strings.Join(args, " ")
+	}
+
+	game, err := parseGameSession(position)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(engineMove(game, bookEnabled))
+	return nil
+}
+
+// accuracyCommand analyzes every game of the PGN files given as arguments,
+// or of the standard input, and prints the accuracy report of each as a
+// line of JSON.
+func accuracyCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("accuracy", flag.ExitOnError)
+	var nodes *int = flags.Int("nodes", defaultAnnotateBudget.nodes, "nodes searched per position")
+	var depth *int = flags.Int("depth", defaultAnnotateBudget.depth, "maximum search depth per position")
+	flags.Parse(args)
+
+	var budget annotateBudget = annotateBudget{nodes: max(*nodes, 1), depth: min(max(*depth, 1), maxSearchDepth)}
+
+	var report = func(reader io.Reader) error {
+		return readPgn(reader, func(pgn *pgnGame) error {
+			analysis, err := annotatePgn(pgn, budget, nil, nil)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(newAccuracyReport(analysis))
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		})
+	}
+
+	if flags.NArg() == 0 {
+		return report(os.Stdin)
+	}
+
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = report(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EvalParams holds every weight used by evaluate. The defaults live in
+// params_default.go and can be replaced at startup from a JSON file
+// (native build) or through ChessLoadParams (WASM build).
+//
+// Pairs are {middlegame, endgame}. Piece-square tables are laid out from
+// white's point of view, a8 first, and are mirrored for black.
+type EvalParams struct {
+	Pawn   [2]int `json:"pawn"`
+	Knight [2]int `json:"knight"`
+	Bishop [2]int `json:"bishop"`
+	Rook   [2]int `json:"rook"`
+	Queen  [2]int `json:"queen"`
+
+	PawnTable   [2][64]int `json:"pawnTable"`
+	KnightTable [2][64]int `json:"knightTable"`
+	BishopTable [2][64]int `json:"bishopTable"`
+	RookTable   [2][64]int `json:"rookTable"`
+	QueenTable  [2][64]int `json:"queenTable"`
+	KingTable   [2][64]int `json:"kingTable"`
+
+	DoubledPawn  [2]int    `json:"doubledPawn"`
+	IsolatedPawn [2]int    `json:"isolatedPawn"`
+	PassedPawn   [2][8]int `json:"passedPawn"` //by rank, counted from the pawn's own side
+
+	PawnShield [2]int `json:"pawnShield"`
+	KingAttack [2]int `json:"kingAttack"` //per attack on the squares around the king
+
+	KnightMobility [2]int `json:"knightMobility"`
+	BishopMobility [2]int `json:"bishopMobility"`
+	RookMobility   [2]int `json:"rookMobility"`
+	QueenMobility  [2]int `json:"queenMobility"`
+}
+
+var params EvalParams = defaultParams
+
+// values returns a pointer to every tunable weight, in a fixed order.
+func (p *EvalParams) values() []*int {
+	var values []*int
+
+	for _, pair := range []*[2]int{&p.Pawn, &p.Knight, &p.Bishop, &p.Rook, &p.Queen} {
+		values = append(values, &pair[0], &pair[1])
+	}
+
+	for _, table := range []*[2][64]int{&p.PawnTable, &p.KnightTable, &p.BishopTable, &p.RookTable, &p.QueenTable, &p.KingTable} {
+		for phase := 0; phase < 2; phase++ {
+			for i := 0; i < 64; i++ {
+				values = append(values, &table[phase][i])
+			}
+		}
+	}
+
+	values = append(values, &p.DoubledPawn[0], &p.DoubledPawn[1])
+	values = append(values, &p.IsolatedPawn[0], &p.IsolatedPawn[1])
+	for phase := 0; phase < 2; phase++ {
+		for i := 0; i < 8; i++ {
+			values = append(values, &p.PassedPawn[phase][i])
+		}
+	}
+
+	for _, pair := range []*[2]int{&p.PawnShield, &p.KingAttack, &p.KnightMobility, &p.BishopMobility, &p.RookMobility, &p.QueenMobility} {
+		values = append(values, &pair[0], &pair[1])
+	}
+
+	return values
+}
+
+// names returns a label for every value, matching the order of values.
+func (p *EvalParams) names() []string {
+	var names []string
+	var phases [2]string = [2]string{"mg", "eg"}
+
+	for _, name := range []string{"pawn", "knight", "bishop", "rook", "queen"} {
+		names = append(names, name+".mg", name+".eg")
+	}
+
+	for _, name := range []string{"pawnTable", "knightTable", "bishopTable", "rookTable", "queenTable", "kingTable"} {
+		for phase := 0; phase < 2; phase++ {
+			for i := 0; i < 64; i++ {
+				names = append(names, fmt.Sprintf("%s.%s.%c%d", name, phases[phase], 97+i%8, 8-i/8))
+			}
+		}
+	}
+
+	names = append(names, "doubledPawn.mg", "doubledPawn.eg")
+	names = append(names, "isolatedPawn.mg", "isolatedPawn.eg")
+	for phase := 0; phase < 2; phase++ {
+		for i := 0; i < 8; i++ {
+			names = append(names, fmt.Sprintf("passedPawn.%s.%d", phases[phase], i+1))
+		}
+	}
+
+	for _, name := range []string{"pawnShield", "kingAttack", "knightMobility", "bishopMobility", "rookMobility", "queenMobility"} {
+		names = append(names, name+".mg", name+".eg")
+	}
+
+	return names
+}
+
+// parseParams decodes a JSON parameter set. Fields missing from the
+// document keep their default value.
+func parseParams(data []byte) (EvalParams, error) {
+	var p EvalParams = defaultParams
+	if err := json.Unmarshal(data, &p); err != nil {
+		return EvalParams{}, fmt.Errorf("invalid parameters: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+const initialFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// pgnGame is one game of a PGN file. Only the main line is kept: comments,
+// variations and numeric annotation glyphs are skipped.
+type pgnGame struct {
+	tags   map[string]string
+	moves  []string //SAN, as written in the file
+	result string   //"1-0", "0-1", "1/2-1/2" or "*"
+}
+
+// start returns the position the game starts from, the FEN tag if present.
+func (g *pgnGame) start() (Game, error) {
+	var fen string = initialFen
+	if tag, ok := g.tags["FEN"]; ok {
+		fen = tag
+	}
+	return loadFen(&fen)
+}
+
+// readPgn calls fn with every game of a PGN stream, stopping at the first
+// error fn returns.
+func readPgn(reader io.Reader, fn func(game *pgnGame) error) error {
+	var scanner *bufio.Scanner = bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var game *pgnGame = &pgnGame{tags: map[string]string{}, result: "*"}
+	var movetext bool = false //the current game has reached its moves
+	var comment bool = false  //inside a {} comment spanning lines
+	var variation int = 0     //depth of () variations
+
+	var flush = func() error {
+		if !movetext && len(game.tags) == 0 {
+			return nil
+		}
+		var err error = fn(game)
+		game = &pgnGame{tags: map[string]string{}, result: "*"}
+		movetext = false
+		return err
+	}
+
+	for scanner.Scan() {
+		var line string = strings.TrimSpace(scanner.Text())
+
+		if !comment && variation == 0 {
+			if strings.HasPrefix(line, "%") { //escaped line
+				continue
+			}
+			if strings.HasPrefix(line, "[") {
+				if movetext {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				if name, value, ok := parsePgnTag(line); ok {
+					game.tags[name] = value
+				}
+				continue
+			}
+		}
+
+		for len(line) > 0 {
+			if comment {
+				var end int = strings.IndexByte(line, '}')
+				if end == -1 {
+					line = ""
+					break
+				}
+				comment = false
+				line = line[end+1:]
+				continue
+			}
+
+			switch line[0] {
+			case ' ', '\t':
+				line = line[1:]
+				continue
+			case '{':
+				comment = true
+				line = line[1:]
+				continue
+			case ';': //rest of line comment
+				line = ""
+				continue
+			case '(':
+				variation++
+				line = line[1:]
+				continue
+			case ')':
+				variation--
+				line = line[1:]
+				continue
+			}
+
+			var end int = strings.IndexAny(line, " \t{};()")
+			if end == -1 {
+				end = len(line)
+			}
+			var token string = line[:end]
+			line = line[end:]
+
+			if variation > 0 {
+				continue
+			}
+			movetext = true
+
+			switch {
+			case token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*":
+				game.result = token
+				if err := flush(); err != nil {
+					return err
+				}
+			case token[0] == '$': //numeric annotation glyph
+			default:
+				//move numbers like "12." or "12..." may be glued to the move
+				if i := strings.LastIndexByte(token, '.'); i > -1 {
+					token = token[i+1:]
+				}
+				if strings.Trim(token, "0123456789") != "" {
+					game.moves = append(game.moves, token)
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if comment || variation > 0 {
+		return errors.New("unterminated comment or variation at the end of the pgn")
+	}
+
+	return flush()
+}
+
+func parsePgnTag(line string) (string, string, bool) {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	var i int = strings.IndexByte(line, ' ')
+	if i == -1 {
+		return "", "", false
+	}
+
+	var value string = strings.TrimSpace(line[i+1:])
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "\""), "\"")
+	value = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value)
+
+	return line[:i], value, true
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Rules queries for the chess window, so that it does not need a move
+// generator of its own. Moves are accepted in coordinate notation or SAN.
+
+// moveFlags tells what a move does, e.g. for the sounds and animations of
+// the chess window.
+type moveFlags struct {
+	Capture        bool   `json:"capture"`
+	EnPassant      bool   `json:"enPassant"`
+	Castle         string `json:"castle,omitempty"`         //"kingside" or "queenside"
+	Rook           string `json:"rook,omitempty"`           //the rook's move when castling, e.g. "h1f1"
+	Promotion      string `json:"promotion,omitempty"`      //"q", "r", "b" or "n"
+	Captured       string `json:"captured,omitempty"`       //the captured piece, "p", "n", "b", "r" or "q"
+	CapturedSquare string `json:"capturedSquare,omitempty"` //not the target square for en passant
+	Check          bool   `json:"check"`
+	Checkmate      bool   `json:"checkmate"`
+}
+
+type legalMove struct {
+	Move string `json:"move"` //UCI notation, e.g. "e7e8q"
+	San  string `json:"san"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	moveFlags
+}
+
+type appliedMove struct {
+	Fen    string `json:"fen"` //the position after the move
+	Move   string `json:"move"`
+	San    string `json:"san"`
+	Status string `json:"status"` //see gameStatus
+	moveFlags
+}
+
+// makeMoveFlags makes a legal move like makeMove and tells what it did.
+func makeMoveFlags(game Game, move Move) (Game, moveFlags) {
+	var flags moveFlags
+	var piece Piece = game.placement[move.p0.x][move.p0.y]
+	var target Piece = game.placement[move.p1.x][move.p1.y]
+
+	if target.piece != 0 {
+		flags.Capture = true
+		flags.Captured = pieceLetter(target.piece)
+		flags.CapturedSquare = squareName(move.p1)
+	} else if piece.piece == Pawn && move.p0.x != move.p1.x {
+		flags.Capture = true
+		flags.EnPassant = true
+		flags.Captured = pieceLetter(Pawn)
+		flags.CapturedSquare = squareName(Position{move.p1.x, move.p0.y})
+	}
+
+	if isCastling(&game, move) {
+		if move.p1.x > move.p0.x {
+			flags.Castle = "kingside"
+			flags.Rook = squareName(Position{7, move.p0.y}) + squareName(Position{5, move.p0.y})
+		} else {
+			flags.Castle = "queenside"
+			flags.Rook = squareName(Position{0, move.p0.y}) + squareName(Position{3, move.p0.y})
+		}
+	}
+
+	var next Game = makeMove(game, move)
+	if piece.piece == Pawn && next.placement[move.p1.x][move.p1.y].piece != Pawn {
+		flags.Promotion = pieceLetter(next.placement[move.p1.x][move.p1.y].piece)
+	}
+
+	flags.Check = inCheck(next, next.color)
+	flags.Checkmate = flags.Check && len(legalMoves(&next, next.color)) == 0
+
+	return next, flags
+}
+
+// parseMove reads a move in coordinate notation or SAN.
+func parseMove(game *Game, text string) (Move, error) {
+	if looksLikeMove(text) {
+		return parseUciMove(game, text)
+	}
+	return parseSan(game, text)
+}
+
+// looksLikeMove tells coordinate moves from SAN and unknown commands.
+func looksLikeMove(text string) bool {
+	if len(text) < 4 || len(text) > 5 {
+		return false
+	}
+	_, from := parseSquare(text[:2])
+	_, to := parseSquare(text[2:4])
+	return from && to
+}
+
+// legalMovesJson lists the legal moves of a fen as JSON, only those of the
+// piece on square unless square is empty.
+func legalMovesJson(fen string, square string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	var from Position
+	if square != "" {
+		var ok bool
+		if from, ok = parseSquare(square); !ok {
+			return "", errors.New("invalid square " + square)
+		}
+	}
+
+	var result []legalMove = []legalMove{}
+	for _, move := range legalMoves(&game, game.color) {
+		if square != "" && move.p0 != from {
+			continue
+		}
+
+		_, flags := makeMoveFlags(game, move)
+		result = append(result, legalMove{
+			Move:      moveToUci(move),
+			San:       moveToSan(&game, move),
+			From:      squareName(move.p0),
+			To:        squareName(move.p1),
+			moveFlags: flags,
+		})
+	}
+
+	data, err := json.Marshal(result)
+	return string(data), err
+}
+
+// applyMove plays a move on a fen and returns the new position as JSON, or
+// an error if the move is not legal.
+func applyMove(fen string, text string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	move, err := parseMove(&game, text)
+	if err != nil {
+		return "", err
+	}
+
+	next, flags := makeMoveFlags(game, move)
+	data, err := json.Marshal(appliedMove{
+		Fen:       toFen(&next),
+		Move:      moveToUci(move),
+		San:       moveToSan(&game, move),
+		Status:    gameStatus(&next),
+		moveFlags: flags,
+	})
+	return string(data), err
+}
+
+// sanOf writes a legal move of a fen in SAN.
+func sanOf(fen string, text string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	move, err := parseMove(&game, text)
+	if err != nil {
+		return "", err
+	}
+
+	return moveToSan(&game, move), nil
+}
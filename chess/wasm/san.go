@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Standard algebraic notation, as used in PGN files: "e4", "Nbd7", "exd6",
+// "O-O", "e8=Q+".
+
+func squareName(p Position) string {
+	return string(rune('a'+p.x)) + string(rune('8'-p.y))
+}
+
+// parseSquare reads a square name like "e4".
+func parseSquare(name string) (Position, bool) {
+	if len(name) != 2 || name[0] < 'a' || name[0] > 'h' || name[1] < '1' || name[1] > '8' {
+		return Position{}, false
+	}
+	return Position{int(name[0] - 'a'), int('8' - name[1])}, true
+}
+
+// parseSan finds the legal move of the position written as san. Check and
+// annotation marks are ignored.
+func parseSan(game *Game, san string) (Move, error) {
+	var text string = strings.TrimRight(san, "+#!?")
+	text = strings.ReplaceAll(text, "0", "O") //0-0 is common in older files
+
+	var moves []Move = legalMoves(game, game.color)
+
+	if text == "O-O" || text == "O-O-O" {
+		for _, move := range moves {
+			if isCastling(game, move) && (move.p1.x == 6) == (text == "O-O") {
+				return move, nil
+			}
+		}
+		return Move{}, errors.New("illegal move " + san)
+	}
+
+	var piece PieceType = Pawn
+	if len(text) > 0 && strings.IndexByte("NBRQK", text[0]) > -1 {
+		piece = pieceFromLetter(text[0])
+		text = text[1:]
+	}
+
+	var promotion PieceType = 0
+	if i := strings.IndexByte(text, '='); i > -1 && i+1 < len(text) {
+		promotion = pieceFromLetter(text[i+1])
+		text = text[:i]
+	} else if piece == Pawn && len(text) > 0 && strings.IndexByte("NBRQ", text[len(text)-1]) > -1 {
+		promotion = pieceFromLetter(text[len(text)-1]) //e8Q
+		text = text[:len(text)-1]
+	}
+
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "x", ""), "-", "")
+	if len(text) < 2 {
+		return Move{}, errors.New("invalid move " + san)
+	}
+
+	to, ok := parseSquare(text[len(text)-2:])
+	if !ok {
+		return Move{}, errors.New("invalid move " + san)
+	}
+
+	//what is left is the file and/or rank of the moving piece
+	var fromX, fromY int = -1, -1
+	for _, c := range text[:len(text)-2] {
+		if c >= 'a' && c <= 'h' {
+			fromX = int(c - 'a')
+		} else if c >= '1' && c <= '8' {
+			fromY = int('8' - c)
+		} else {
+			return Move{}, errors.New("invalid move " + san)
+		}
+	}
+
+	var found []Move
+	for _, move := range moves {
+		if move.p1 != to || game.placement[move.p0.x][move.p0.y].piece != piece || move.promotion != promotion {
+			continue
+		}
+		if (fromX > -1 && move.p0.x != fromX) || (fromY > -1 && move.p0.y != fromY) {
+			continue
+		}
+		found = append(found, move)
+	}
+
+	if len(found) == 0 {
+		return Move{}, errors.New("illegal move " + san)
+	}
+	if len(found) > 1 {
+		return Move{}, errors.New("ambiguous move " + san)
+	}
+
+	return found[0], nil
+}
+
+// moveToSan writes a legal move in standard algebraic notation.
+func moveToSan(game *Game, move Move) string {
+	var builder strings.Builder
+	var piece Piece = game.placement[move.p0.x][move.p0.y]
+	var capture bool = game.placement[move.p1.x][move.p1.y].piece != 0 || (piece.piece == Pawn && move.p0.x != move.p1.x)
+
+	if isCastling(game, move) {
+		if move.p1.x == 6 {
+			builder.WriteString("O-O")
+		} else {
+			builder.WriteString("O-O-O")
+		}
+	} else if piece.piece == Pawn {
+		if capture {
+			builder.WriteByte(byte('a' + move.p0.x))
+			builder.WriteString("x")
+		}
+		builder.WriteString(squareName(move.p1))
+		if move.promotion != 0 {
+			builder.WriteString("=" + strings.ToUpper(pieceLetter(move.promotion)))
+		}
+	} else {
+		builder.WriteString(strings.ToUpper(pieceLetter(piece.piece)))
+
+		//disambiguate between pieces of the same kind reaching the square
+		var sameFile, sameRank, other bool
+		for _, m := range legalMoves(game, game.color) {
+			if m.p1 != move.p1 || m.p0 == move.p0 || game.placement[m.p0.x][m.p0.y].piece != piece.piece {
+				continue
+			}
+			other = true
+			sameFile = sameFile || m.p0.x == move.p0.x
+			sameRank = sameRank || m.p0.y == move.p0.y
+		}
+		if other {
+			if !sameFile {
+				builder.WriteByte(byte('a' + move.p0.x))
+			} else if !sameRank {
+				builder.WriteByte(byte('8' - move.p0.y))
+			} else {
+				builder.WriteString(squareName(move.p0))
+			}
+		}
+
+		if capture {
+			builder.WriteString("x")
+		}
+		builder.WriteString(squareName(move.p1))
+	}
+
+	var next Game = makeMove(*game, move)
+	if inCheck(next, next.color) {
+		if len(legalMoves(&next, next.color)) == 0 {
+			builder.WriteString("#")
+		} else {
+			builder.WriteString("+")
+		}
+	}
+
+	return builder.String()
+}
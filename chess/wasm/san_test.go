@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+// findMove returns the legal move from one square to another, e.g. "e7e8"
+// with promotion Queen.
+func findMove(game *Game, text string, promotion PieceType) (Move, bool) {
+	for _, move := range legalMoves(game, game.color) {
+		if squareName(move.p0)+squareName(move.p1) == text && move.promotion == promotion {
+			return move, true
+		}
+	}
+	return Move{}, false
+}
+
+func TestMoveToSan(t *testing.T) {
+	var tests = []struct {
+		fen       string
+		move      string
+		promotion PieceType
+		san       string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1f3", 0, "Nf3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", 0, "e4"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", 0, "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1c1", 0, "O-O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e5f7", 0, "Nxf7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "d5e6", 0, "dxe6"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0, "exd6"},
+		{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", "d7c8", Queen, "dxc8=Q"},
+		{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", "d7c8", Knight, "dxc8=N"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", 0, "R1a3"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a5a3", 0, "R5a3"},
+		{"4k3/8/8/8/8/8/8/1N3NK1 w - - 0 1", "b1d2", 0, "Nbd2"},
+		{"4k3/8/8/8/8/Q1Q5/8/Q3K3 w - - 0 1", "a1b2", 0, "Q1b2"},
+		{"4k3/8/8/8/8/Q1Q5/8/Q3K3 w - - 0 1", "a3b2", 0, "Qa3b2"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", 0, "Ra8+"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", 0, "Ra8#"},
+	}
+
+	for _, test := range tests {
+		var fen string = test.fen
+		game, err := loadFen(&fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.fen, err)
+		}
+		move, ok := findMove(&game, test.move, test.promotion)
+		if !ok {
+			t.Errorf("%s: %s is not legal", test.fen, test.move)
+			continue
+		}
+		if got := moveToSan(&game, move); got != test.san {
+			t.Errorf("%s: %s written %q, want %q", test.fen, test.move, got, test.san)
+		}
+	}
+}
+
+// Every legal move, two plies deep, is read back from its SAN as the same
+// move.
+func TestSanRoundTrip(t *testing.T) {
+	var fens []string = []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"4k3/8/8/8/8/Q1Q5/8/Q3K3 w - - 0 1",
+	}
+
+	var root string //the fen the position was reached from
+	var walk func(game *Game, depth int)
+	walk = func(game *Game, depth int) {
+		for _, move := range legalMoves(game, game.color) {
+			var san string = moveToSan(game, move)
+			parsed, err := parseSan(game, san)
+			if err != nil || parsed != move {
+				t.Errorf("from %s: %s read back as %v, %v", root, san, parsed, err)
+			}
+			if depth > 1 {
+				var next Game = makeMove(*game, move)
+				walk(&next, depth-1)
+			}
+		}
+	}
+
+	for _, fen := range fens {
+		game, err := loadFen(&fen)
+		if err != nil {
+			t.Fatalf("%s: %v", fen, err)
+		}
+		root = fen
+		walk(&game, 2)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const maxSearchDepth = 64
+
+// Verbosity levels of the search telemetry.
+const (
+	verbosityQuiet      = 0 //only the result
+	verbosityIterations = 1 //after every completed depth
+	verbosityMoves      = 2 //also whenever the search turns to the next root move
+)
+
+var verbosity int = verbosityIterations
+
+// iterate searches one ply deeper at a time until maxDepth or until the
+// search is stopped, and returns the lines of the last completed depth. The
+// best move of every depth is searched first at the next one. report, if
+// not nil, is called after every completed depth.
+func (s *search) iterate(game *Game, maxDepth int, count int, report func(depth int, lines []searchLine)) []searchLine {
+	var result []searchLine
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+
+	for depth := 1; depth <= maxDepth; depth++ {
+		var lines []searchLine = s.multiPV(game, depth, count)
+		if s.stopped && result != nil {
+			break
+		}
+		if len(lines) == 0 {
+			break
+		}
+
+		result = lines
+		s.first = lines[0].move
+		if report != nil {
+			report(depth, lines)
+		}
+
+		//a mate that is found does not get any shorter
+		if mate := mateIn(lines[0].Score); mate != 0 && abs(mate)*2 <= depth+1 {
+			break
+		}
+		if s.stopped {
+			break
+		}
+	}
+
+	//stopped before the first depth completed
+	if result == nil {
+		var moves []Move = legalMoves(game, game.color)
+		if len(moves) > 0 {
+			result = []searchLine{newSearchLine(game, 0, []Move{moves[0]})}
+		}
+	}
+
+	return result
+}
+
+// engineResult is the engine's answer for a position, as handed to the
+// chess window.
+type engineResult struct {
+	Move   string   `json:"move,omitempty"` //UCI notation, e.g. "e2e4" or "e7e8q"
+	San    string   `json:"san,omitempty"`
+	Score  int      `json:"score"`          //centipawns, side to move's point of view
+	Mate   *int     `json:"mate,omitempty"` //moves to mate, negative when getting mated, 0 when checkmated already
+	Wdl    *wdl     `json:"wdl,omitempty"`  //chances of the side to move, from the score
+	Depth  int      `json:"depth"`
+	Pv     []string `json:"pv"` //UCI notation, starting with the move
+	Nodes  int      `json:"nodes"`
+	Time   int64    `json:"time"` //milliseconds
+	Book   bool     `json:"book,omitempty"`
+	Status string   `json:"status"` //of the game after the move, see gameStatus
+	Error  string   `json:"error,omitempty"`
+	moveFlags
+}
+
+// engineMove picks the move to play in the current position of a game at
+// the current skill level, from the book if useBook is set and the book has
+// a move. The game's history lets the search avoid or seek repetitions.
+// Without a legal move only the status is set.
+func engineMove(g *GameSession, useBook bool) engineResult {
+	var start time.Time = time.Now()
+	var game *Game = g.current()
+
+	var s search = search{history: g.history()}
+	if useBook {
+		if move, ok := chooseBookMove(game, bookBestMove); ok {
+			var result engineResult = newEngineResult(g, newSearchLine(game, 0, []Move{move}), 0, 0, start)
+			result.Book = true
+			return result
+		}
+	}
+
+	line, depth := s.skillMove(game, skill)
+	return newEngineResult(g, line, depth, s.nodes, start)
+}
+
+func newEngineResult(g *GameSession, line searchLine, depth int, nodes int, start time.Time) engineResult {
+	var result engineResult = engineResult{Pv: []string{}}
+
+	if line.move == (Move{}) {
+		result.Status = g.status()
+		if result.Status == "checkmate" {
+			result.Score = -mateScore
+			result.Mate = new(int)
+		}
+		return result
+	}
+
+	result.Move = moveToUci(line.move)
+	result.San = line.San
+	result.Score = line.Score
+	if line.Mate != 0 {
+		var mate int = line.Mate
+		result.Mate = &mate
+	}
+	var chances wdl = scoreWdl(g.current(), line.Score)
+	result.Wdl = &chances
+	result.Depth = depth
+	result.Nodes = nodes
+	result.Time = time.Since(start).Milliseconds()
+	for _, move := range line.pv {
+		result.Pv = append(result.Pv, moveToUci(move))
+	}
+
+	result.Status = g.statusAfter(line.move)
+	_, result.moveFlags = makeMoveFlags(*g.current(), line.move)
+
+	return result
+}
+
+// searchInfo is the telemetry of a running search.
+type searchInfo struct {
+	Depth            int    `json:"depth"`
+	SelDepth         int    `json:"seldepth"` //deepest ply reached
+	Nodes            int    `json:"nodes"`
+	Nps              int    `json:"nps"`
+	Time             int64  `json:"time"`             //milliseconds
+	Hashfull         int    `json:"hashfull"`         //permille of the transposition table in use
+	TtHits           int    `json:"ttHits"`           //percent of the table probes that found the position
+	Cutoffs          int    `json:"cutoffs"`          //beta cutoffs
+	FirstMoveCutoffs int    `json:"firstMoveCutoffs"` //percent of the cutoffs by the first move, the better the move ordering the higher
+	CurrMove         string `json:"currMove,omitempty"`
+	CurrMoveNumber   int    `json:"currMoveNumber,omitempty"`
+}
+
+func (s *search) info(depth int) searchInfo {
+	var info searchInfo = searchInfo{
+		Depth:    depth,
+		SelDepth: s.selDepth,
+		Nodes:    s.nodes,
+		Time:     time.Since(s.start).Milliseconds(),
+		Cutoffs:  s.cutoffs,
+	}
+
+	info.Nps = int(int64(s.nodes) * 1000 / max(info.Time, 1))
+	if s.table != nil {
+		info.Hashfull = s.table.hashfull()
+	}
+	if s.ttProbes > 0 {
+		info.TtHits = s.ttHits * 100 / s.ttProbes
+	}
+	if s.cutoffs > 0 {
+		info.FirstMoveCutoffs = s.firstCutoffs * 100 / s.cutoffs
+	}
+
+	return info
+}
+
+func (i searchInfo) String() string {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return errorJson(err)
+	}
+	return string(data)
+}
+
+// searchProgress is reported after every completed depth of a search.
+type searchProgress struct {
+	searchInfo
+	Lines []searchLine `json:"lines"`
+}
+
+func (p searchProgress) String() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return errorJson(err)
+	}
+	return string(data)
+}
+
+func (r engineResult) String() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errorJson(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// A session is one game of the engine, e.g. the game of one chess window.
+// It keeps the game with the positions that led to the current one, its own
+// playing strength and book settings, and a transposition table that
+// outlives the single searches, so several windows can play independent
+// games.
+
+type session struct {
+	game     *GameSession
+	skill    int
+	book     bool //consult the opening book
+	bookBest bool //always play the highest weighted book move
+	lines    int  //principal variations searched and reported
+	table    *transpositionTable
+}
+
+const (
+	defaultHashSize = 4    //megabytes
+	maxHashSize     = 1024 //larger tables fail to allocate in a browser
+)
+
+func newSession() *session {
+	var e *session = &session{skill: maxSkill, book: true, lines: 1, table: newTranspositionTable(defaultHashSize)}
+	e.newGame()
+	return e
+}
+
+// newGame starts over from the initial position and forgets what the
+// previous game taught the transposition table.
+func (e *session) newGame() {
+	var fen string = initialFen
+	start, _ := loadFen(&fen)
+	e.game = newGameSession(start)
+	if e.table != nil {
+		e.table.clear()
+	}
+}
+
+// setPosition sets up a fen and plays moves from there, in coordinate
+// notation or SAN. The session is unchanged if any of it is invalid.
+func (e *session) setPosition(fen string, moves []string) error {
+	start, err := loadFen(&fen)
+	if err != nil {
+		return err
+	}
+
+	var game *GameSession = newGameSession(start)
+	for _, text := range moves {
+		move, err := parseMove(game.current(), text)
+		if err != nil {
+			return err
+		}
+		game.play(move)
+	}
+
+	e.game = game
+	return nil
+}
+
+// play makes a move, in coordinate notation or SAN, if it is legal.
+func (e *session) play(text string) (appliedMove, error) {
+	move, err := parseMove(e.game.current(), text)
+	if err != nil {
+		return appliedMove{}, err
+	}
+
+	var san string = moveToSan(e.game.current(), move)
+	_, flags := makeMoveFlags(*e.game.current(), move)
+	e.game.play(move)
+
+	return appliedMove{Fen: toFen(e.game.current()), Move: moveToUci(move), San: san, Status: e.game.status(), moveFlags: flags}, nil
+}
+
+// setOption changes a setting: skill (1 to 20), elo (600 to 2500), book
+// and bookBest (true or false), lines (1 or more) or hash (megabytes, which
+// also clears the table).
+func (e *session) setOption(name string, value string) error {
+	switch name {
+	case "skill":
+		level, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.skill = min(max(level, 1), maxSkill)
+	case "elo":
+		elo, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.skill = skillForElo(elo)
+	case "book":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		e.book = enabled
+	case "bookBest":
+		best, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		e.bookBest = best
+	case "lines":
+		lines, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.lines = max(lines, 1)
+	case "hash":
+		megabytes, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.table = newTranspositionTable(min(max(megabytes, 1), maxHashSize))
+	default:
+		return errors.New("unknown option " + name)
+	}
+
+	return nil
+}
+
+// think finds the move to play in the current position of g with the
+// settings of the session. report, if not nil, is called with the result of
+// every completed depth.
+func (e *session) think(s *search, g *GameSession, depth int, start time.Time, report func(result engineResult, lines []searchLine)) engineResult {
+	var game *Game = g.current()
+	s.table = e.table
+	s.history = g.history()
+
+	if e.book {
+		if move, ok := chooseBookMove(game, e.bookBest); ok {
+			var result engineResult = newEngineResult(g, newSearchLine(game, 0, []Move{move}), 0, 0, start)
+			result.Book = true
+			return result
+		}
+	}
+
+	if e.skill < maxSkill {
+		line, reached := s.skillMove(game, e.skill)
+		return newEngineResult(g, line, reached, s.nodes, start)
+	}
+
+	var reached int = 0
+	var lines []searchLine = s.iterate(game, depth, e.lines, func(depth int, lines []searchLine) {
+		reached = depth
+		if report != nil {
+			report(newEngineResult(g, lines[0], depth, s.nodes, start), lines)
+		}
+	})
+
+	var line searchLine
+	if len(lines) > 0 {
+		line = lines[0]
+	}
+	return newEngineResult(g, line, reached, s.nodes, start)
+}
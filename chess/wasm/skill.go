@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Skill levels from 1 to 20. Level 20 is the full strength engine, lower
+// levels search shallower with a node budget, pick among the best few moves
+// at random with a preference for the better ones, and now and then play a
+// random move outright.
+
+const maxSkill = 20
+
+var skill int = maxSkill
+
+type skillSettings struct {
+	depth       int
+	nodes       int //node budget after the first iteration, 0 for none
+	candidates  int //moves considered for the random choice
+	temperature int //centipawns, how much worse moves are still likely
+	blunder     int //percent chance of a random move
+}
+
+func skillFor(level int) skillSettings {
+	level = min(max(level, 1), maxSkill)
+
+	if level == maxSkill {
+		return skillSettings{depth: 3, candidates: 1}
+	}
+
+	return skillSettings{
+		depth:       1 + level/8,
+		nodes:       200 << (level / 2),
+		candidates:  4,
+		temperature: (maxSkill - level) * 12,
+		blunder:     maxSkill - level,
+	}
+}
+
+// skillForElo maps a rating between 600 and 2500 to a skill level.
+func skillForElo(elo int) int {
+	return min(max(1+(elo-600)*(maxSkill-1)/1900, 1), maxSkill)
+}
+
+// skillMove chooses the line to play at a skill level and returns it with
+// the depth it was searched to. The line has no move when the game is over.
+func (s *search) skillMove(game *Game, level int) (searchLine, int) {
+	var settings skillSettings = skillFor(level)
+	if settings.candidates == 1 {
+		var lines []searchLine = s.iterate(game, settings.depth, 1, nil)
+		if len(lines) == 0 {
+			return searchLine{}, 0
+		}
+		return lines[0], settings.depth
+	}
+
+	if rand.Intn(100) < settings.blunder {
+		var move Move = randomMove(game)
+		if move == (Move{}) {
+			return searchLine{}, 0
+		}
+		return newSearchLine(game, 0, []Move{move}), 0
+	}
+
+	//iterative deepening within the node budget
+	var lines []searchLine
+	var reached int = 0
+	for depth := 1; depth <= settings.depth; depth++ {
+		if depth > 1 {
+			s.nodeLimit = settings.nodes
+		}
+		var tmp []searchLine = s.multiPV(game, depth, settings.candidates)
+		if s.stopped {
+			break
+		}
+		lines = tmp
+		reached = depth
+	}
+
+	if len(lines) == 0 {
+		return searchLine{}, 0
+	}
+
+	//the best line is the most likely, worse ones fade with the temperature
+	var weights []float64 = make([]float64, len(lines))
+	var total float64 = 0
+	for i, line := range lines {
+		var loss float64 = float64(min(lines[0].Score-line.Score, 2000))
+		weights[i] = math.Exp(-loss / float64(max(settings.temperature, 1)))
+		total += weights[i]
+	}
+
+	var r float64 = rand.Float64() * total
+	for i, line := range lines {
+		if r < weights[i] {
+			return line, reached
+		}
+		r -= weights[i]
+	}
+
+	return lines[0], reached
+}
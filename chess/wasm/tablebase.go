@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Endgame tablebases with win/draw/loss and distance to mate for up to four
+// pieces, as written by the native tbgen command.
+//
+// A table covers one material signature, e.g. "KRKP" for a white king and
+// rook against a black king and pawn. Positions with the colors reversed
+// are probed by flipping the board. Every piece has its own square in the
+// index, white first in signature order, followed by the side to move. The
+// first white king is kept on files a-d (and ranks 5-8 without pawns) by
+// mirroring the board.
+//
+// File format: "OPTB", a version byte, the signature length and signature,
+// the number of entries (uint32, little endian) and the flate compressed
+// entries, one byte per position:
+//
+//	0        draw, or an illegal position
+//	1-127    the side to move mates in this many plies
+//	128-255  the side to move is mated in (value - 128) plies
+
+const tablebaseMagic = "OPTB"
+const tablebaseVersion = 1
+const tablebaseMaxPieces = 4
+
+type tablebase struct {
+	key    string
+	pieces []Piece //piece of every index slot
+	pawns  bool
+	packed []byte //compressed entries, decoded on the first probe
+	data   []byte
+	once   sync.Once
+	err    error
+}
+
+var tablebases map[string]*tablebase = map[string]*tablebase{}
+var tablebasesMutex sync.Mutex
+
+// splitMaterialKey splits a signature into white's and black's pieces.
+func splitMaterialKey(key string) (string, string, error) {
+	if len(key) < 2 || key[0] != 'K' || strings.Count(key, "K") != 2 || strings.Trim(key, "KQRBNP") != "" {
+		return "", "", errors.New("invalid material signature " + key)
+	}
+	var i int = strings.Index(key[1:], "K") + 1
+	return key[:i], key[i:], nil
+}
+
+func newTablebase(key string) (*tablebase, error) {
+	white, black, err := splitMaterialKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > tablebaseMaxPieces {
+		return nil, errors.New("too many pieces for a tablebase: " + key)
+	}
+
+	var tb *tablebase = &tablebase{key: key, pawns: strings.Contains(key, "P")}
+	for _, letter := range white {
+		tb.pieces = append(tb.pieces, Piece{pieceFromLetter(byte(letter)), White})
+	}
+	for _, letter := range black {
+		tb.pieces = append(tb.pieces, Piece{pieceFromLetter(byte(letter)), Black})
+	}
+
+	return tb, nil
+}
+
+func pieceFromLetter(letter byte) PieceType {
+	switch letter {
+	case 'P', 'p':
+		return Pawn
+	case 'N', 'n':
+		return Knight
+	case 'B', 'b':
+		return Bishop
+	case 'R', 'r':
+		return Rook
+	case 'Q', 'q':
+		return Queen
+	case 'K', 'k':
+		return King
+	}
+	return 0
+}
+
+func (tb *tablebase) size() int {
+	var size int = 2 * 32
+	if !tb.pawns {
+		size = 2 * 16
+	}
+	for i := 1; i < len(tb.pieces); i++ {
+		size *= 64
+	}
+	return size
+}
+
+// index maps the squares of the pieces, in slot order, to an entry.
+// Mirrored positions share an entry.
+func (tb *tablebase) index(squares []Position, whiteToMove bool) int {
+	var flipX bool = squares[0].x > 3
+	var flipY bool = !tb.pawns && squares[0].y > 3
+	var index int = 0
+
+	for i, p := range squares {
+		if flipX {
+			p.x = 7 - p.x
+		}
+		if flipY {
+			p.y = 7 - p.y
+		}
+
+		if i == 0 {
+			index = p.y*4 + p.x
+		} else {
+			index = index*64 + p.y*8 + p.x
+		}
+	}
+
+	index *= 2
+	if whiteToMove {
+		index++
+	}
+
+	return index
+}
+
+func (tb *tablebase) decode(index int) ([]Position, bool) {
+	var whiteToMove bool = index%2 == 1
+	index /= 2
+
+	var squares []Position = make([]Position, len(tb.pieces))
+	for i := len(squares) - 1; i > 0; i-- {
+		squares[i] = Position{index % 8, (index / 8) % 8}
+		index /= 64
+	}
+	squares[0] = Position{index % 4, index / 4}
+
+	return squares, whiteToMove
+}
+
+// game builds the position of an entry. It fails for illegal positions:
+// pieces sharing a square, pawns on the first or last rank, or the side
+// that just moved left in check.
+func (tb *tablebase) game(squares []Position, whiteToMove bool) (Game, bool) {
+	var game Game = Game{color: Black, castling: "-", enPassant: "-", halfMove: "0", fullMove: "1"}
+	if whiteToMove {
+		game.color = White
+	}
+
+	for i, p := range squares {
+		if game.placement[p.x][p.y].piece != 0 {
+			return game, false
+		}
+		if tb.pieces[i].piece == Pawn && (p.y == 0 || p.y == 7) {
+			return game, false
+		}
+		game.placement[p.x][p.y] = tb.pieces[i]
+	}
+
+	return game, !inCheck(game, flipColor(game.color))
+}
+
+func (tb *tablebase) entries() ([]byte, error) {
+	tb.once.Do(func() {
+		if tb.data != nil {
+			return
+		}
+		var reader io.ReadCloser = flate.NewReader(bytes.NewReader(tb.packed))
+		defer reader.Close()
+		tb.data, tb.err = io.ReadAll(reader)
+		if tb.err == nil && len(tb.data) != tb.size() {
+			tb.err = errors.New("corrupt tablebase " + tb.key)
+		}
+		tb.packed = nil
+	})
+	return tb.data, tb.err
+}
+
+func encodeTablebase(tb *tablebase) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(tablebaseMagic)
+	buffer.WriteByte(tablebaseVersion)
+	buffer.WriteByte(byte(len(tb.key)))
+	buffer.WriteString(tb.key)
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(tb.data)))
+
+	writer, err := flate.NewWriter(&buffer, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(tb.data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// parseTablebase reads a tablebase file. The entries stay compressed until
+// the table is first probed.
+func parseTablebase(data []byte) (*tablebase, error) {
+	if len(data) < 6 || string(data[:4]) != tablebaseMagic {
+		return nil, errors.New("not a tablebase file")
+	}
+	if data[4] != tablebaseVersion {
+		return nil, errors.New("unsupported tablebase version")
+	}
+
+	var length int = int(data[5])
+	if len(data) < 6+length+4 {
+		return nil, errors.New("truncated tablebase file")
+	}
+
+	tb, err := newTablebase(string(data[6 : 6+length]))
+	if err != nil {
+		return nil, err
+	}
+
+	if int(binary.LittleEndian.Uint32(data[6+length:])) != tb.size() {
+		return nil, errors.New("tablebase size mismatch for " + tb.key)
+	}
+
+	tb.packed = data[6+length+4:]
+
+	return tb, nil
+}
+
+func registerTablebase(tb *tablebase) {
+	tablebasesMutex.Lock()
+	defer tablebasesMutex.Unlock()
+	tablebases[tb.key] = tb
+}
+
+func tablebasesLoaded() bool {
+	tablebasesMutex.Lock()
+	defer tablebasesMutex.Unlock()
+	return len(tablebases) > 0
+}
+
+func findTablebase(key string) *tablebase {
+	tablebasesMutex.Lock()
+	defer tablebasesMutex.Unlock()
+	return tablebases[key]
+}
+
+// probeTablebaseValue looks up the entry of a position. Bare kings are
+// always a draw.
+func probeTablebaseValue(game *Game) (byte, bool) {
+	if game.castling != "-" || game.enPassant != "-" || !tablebasesLoaded() {
+		return 0, false
+	}
+
+	white, black := materialKeys(game)
+	if len(white)+len(black) > tablebaseMaxPieces {
+		return 0, false
+	}
+	if white == "K" && black == "K" {
+		return 0, true
+	}
+
+	var flip bool = false
+	var tb *tablebase = findTablebase(white + black)
+	if tb == nil {
+		tb = findTablebase(black + white)
+		flip = true
+	}
+	if tb == nil {
+		return 0, false
+	}
+
+	data, err := tb.entries()
+	if err != nil {
+		return 0, false
+	}
+
+	//put every piece in its slot, the strong side's pieces as white
+	var squares []Position = make([]Position, len(tb.pieces))
+	var used []bool = make([]bool, len(tb.pieces))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			if piece.piece == 0 {
+				continue
+			}
+
+			var p Position = Position{x, y}
+			if flip {
+				piece.color = flipColor(piece.color)
+				p.y = 7 - y
+			}
+
+			for i := 0; i < len(tb.pieces); i++ {
+				if !used[i] && tb.pieces[i] == piece {
+					squares[i] = p
+					used[i] = true
+					break
+				}
+			}
+		}
+	}
+
+	var whiteToMove bool = (game.color == White) != flip
+	return data[tb.index(squares, whiteToMove)], true
+}
+
+// probeTablebase returns the score of a position in search units, mates
+// counted from the root, and whether a table covers it.
+func probeTablebase(game *Game, ply int) (int, bool) {
+	value, ok := probeTablebaseValue(game)
+	if !ok {
+		return 0, false
+	}
+
+	if value == 0 {
+		return 0, true
+	}
+	if value < 128 {
+		return mateScore - ply - int(value), true
+	}
+	return -mateScore + ply + int(value-128), true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+// generateTestTablebases generates KPK, and the KQK and KRK tables it
+// depends on, in a temporary directory.
+func generateTestTablebases(t *testing.T) {
+	t.Helper()
+	if err := generateTablebase("KPK", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tablebaseEntry is the entry of a position without castling rights.
+func tablebaseEntry(t *testing.T, fen string) byte {
+	t.Helper()
+	game, err := loadFen(&fen)
+	if err != nil {
+		t.Fatalf("%s: %v", fen, err)
+	}
+	value, ok := probeTablebaseValue(&game)
+	if !ok {
+		t.Fatalf("%s: no table", fen)
+	}
+	return value
+}
+
+func TestTablebaseProbe(t *testing.T) {
+	generateTestTablebases(t)
+
+	var tests = []struct {
+		name  string
+		fen   string
+		value byte
+	}{
+		{"mated", "1Q5k/8/6K1/8/8/8/8/8 b - - 0 1", 128},
+		{"mate in one", "7k/8/6K1/8/8/8/8/1Q6 w - - 0 1", 1},
+		{"mate in one, colors reversed", "1q6/8/8/8/8/6k1/8/7K b - - 0 1", 1},
+		{"rook mates in one", "7k/8/6K1/8/8/8/8/R7 w - - 0 1", 1},
+		{"mated by a defended queen", "8/8/8/8/8/2k5/1q6/K7 w - - 0 1", 128},
+		{"queen en prise", "8/8/8/8/8/8/1q6/K6k w - - 0 1", 0},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 0},
+		{"pawn stalemate", "4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", 0},
+		{"rook pawn", "k7/8/1K6/P7/8/8/8/8 w - - 0 1", 0},
+	}
+
+	for _, test := range tests {
+		if got := tablebaseEntry(t, test.fen); got != test.value {
+			t.Errorf("%s: entry %d, want %d", test.name, got, test.value)
+		}
+	}
+
+	//the king in front of its pawn on the sixth rank wins, whoever moves
+	if value := tablebaseEntry(t, "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1"); value == 0 || value >= 128 {
+		t.Errorf("king on the sixth, white to move: entry %d, want a win", value)
+	}
+	if value := tablebaseEntry(t, "4k3/8/4K3/4P3/8/8/8/8 b - - 0 1"); value < 128 {
+		t.Errorf("king on the sixth, black to move: entry %d, want a loss", value)
+	}
+}
+
+// The longest wins are the known ones: mate in 10 with the queen, in 16 with
+// the rook.
+func TestTablebaseLongestMate(t *testing.T) {
+	generateTestTablebases(t)
+
+	for key, want := range map[string]byte{"KQK": 19, "KRK": 31} {
+		data, err := findTablebase(key).entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var longest byte = 0
+		for _, value := range data {
+			if value < 128 {
+				longest = max(longest, value)
+			}
+		}
+		if longest != want {
+			t.Errorf("%s: longest mate %d plies, want %d", key, longest, want)
+		}
+	}
+}
+
+// The KPK bitbase of the evaluation agrees with the generated table on
+// every legal position.
+func TestKpkAgreesWithTablebase(t *testing.T) {
+	generateTestTablebases(t)
+
+	for pawn := 8; pawn < 56; pawn++ {
+		for whiteKing := 0; whiteKing < 64; whiteKing++ {
+			for blackKing := 0; blackKing < 64; blackKing++ {
+				var p, wk, bk Position = Position{pawn % 8, pawn / 8}, Position{whiteKing % 8, whiteKing / 8}, Position{blackKing % 8, blackKing / 8}
+				if wk == p || bk == p || distance(wk, bk) <= 1 {
+					continue
+				}
+
+				for _, color := range []PieceColor{White, Black} {
+					var game Game = Game{color: color, castling: "-", enPassant: "-", halfMove: "0", fullMove: "1"}
+					game.placement[p.x][p.y] = Piece{piece: Pawn, color: White}
+					game.placement[wk.x][wk.y] = Piece{piece: King, color: White}
+					game.placement[bk.x][bk.y] = Piece{piece: King, color: Black}
+					if inCheck(game, flipColor(color)) {
+						continue
+					}
+
+					value, _ := probeTablebaseValue(&game)
+					var win bool = value > 0 && value < 128
+					if color == Black {
+						win = value >= 128
+					}
+					if probeKPK(wk, p, bk, White, color == White) != win {
+						t.Errorf("king %v, pawn %v against king %v, color %d to move: bitbase and table disagree", wk, p, bk, color)
+					}
+				}
+			}
+		}
+	}
+}
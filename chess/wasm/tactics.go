@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Tactical motifs, found on the attack maps of the position and confirmed
+// by a short search: a fork that loses the forking piece is still reported
+// as a fork, but the move is not sound.
+
+const (
+	motifFork              = "fork"
+	motifAbsolutePin       = "absolutePin" //the pinned piece cannot move without exposing its king
+	motifRelativePin       = "relativePin" //moving the pinned piece exposes a more valuable one
+	motifSkewer            = "skewer"
+	motifDiscoveredAttack  = "discoveredAttack"
+	motifDiscoveredCheck   = "discoveredCheck"
+	motifDoubleCheck       = "doubleCheck"
+	motifRemovalOfDefender = "removalOfDefender"
+	motifCheckmate         = "checkmate"
+	motifBackRankMate      = "backRankMate"
+	motifSmotheredMate     = "smotheredMate"
+)
+
+const (
+	tacticDepth  = 2   //plies searched after the move to confirm it, captures resolved beyond
+	tacticMargin = 100 //centipawns the move has to win to be sound
+)
+
+type tactic struct {
+	Motif   string   `json:"motif"`
+	Square  string   `json:"square"`  //the piece carrying out the tactic
+	Piece   string   `json:"piece"`   //its letter, upper case for white
+	Targets []string `json:"targets"` //the pieces attacked, pinned or skewered, or the king
+}
+
+type tacticsReport struct {
+	Fen     string   `json:"fen"`
+	Move    string   `json:"move,omitempty"`
+	San     string   `json:"san,omitempty"`
+	Tactics []tactic `json:"tactics"`
+	Gain    int      `json:"gain,omitempty"`  //material the move wins, in centipawns, at the end of the line the search expects
+	Sound   bool     `json:"sound,omitempty"` //the move mates or wins at least tacticMargin
+}
+
+func newTactic(game *Game, motif string, square Position, targets ...Position) tactic {
+	var result tactic = tactic{Motif: motif, Square: squareName(square), Piece: pieceCode(game.placement[square.x][square.y]), Targets: []string{}}
+	for _, target := range targets {
+		result.Targets = append(result.Targets, squareName(target))
+	}
+	return result
+}
+
+// lineTactics finds the pins and skewers of the sliding piece on p: the
+// first two enemy pieces on one of its lines, with nothing else between
+// them.
+func lineTactics(game *Game, p Position) []tactic {
+	var piece Piece = game.placement[p.x][p.y]
+	var result []tactic
+
+	if piece.piece != Bishop && piece.piece != Rook && piece.piece != Queen {
+		return result
+	}
+
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			var diagonal bool = dx != 0 && dy != 0
+			if (dx == 0 && dy == 0) || (piece.piece == Bishop && !diagonal) || (piece.piece == Rook && diagonal) {
+				continue
+			}
+
+			var hit []Position
+			for x, y := p.x+dx, p.y+dy; x >= 0 && x < 8 && y >= 0 && y < 8 && len(hit) < 2; x, y = x+dx, y+dy {
+				if game.placement[x][y].piece != 0 {
+					hit = append(hit, Position{x, y})
+				}
+			}
+			if len(hit) < 2 {
+				continue
+			}
+
+			//pawns pinned to anything but the king and pieces not worth
+			//winning behind the line are left out
+			var front, behind Piece = game.placement[hit[0].x][hit[0].y], game.placement[hit[1].x][hit[1].y]
+			if front.color == piece.color || behind.color == piece.color {
+				continue
+			}
+
+			switch {
+			case behind.piece == King:
+				result = append(result, newTactic(game, motifAbsolutePin, p, hit[0]))
+			case front.piece == Pawn:
+			case !threatened(game, p, hit[1]):
+			case front.piece == King || (exchangeValue(front.piece) > exchangeValue(behind.piece) && threatened(game, p, hit[0])):
+				result = append(result, newTactic(game, motifSkewer, p, hit[0], hit[1]))
+			case exchangeValue(behind.piece) > exchangeValue(front.piece):
+				result = append(result, newTactic(game, motifRelativePin, p, hit[0], hit[1]))
+			}
+		}
+	}
+
+	return result
+}
+
+// threatened tells whether the piece on target is worth the attack of the
+// piece on p: the king, a more valuable piece or an undefended one.
+func threatened(game *Game, p Position, target Position) bool {
+	var attacker, piece Piece = game.placement[p.x][p.y], game.placement[target.x][target.y]
+	if piece.piece == 0 || piece.color == attacker.color {
+		return false
+	}
+	return piece.piece == King || exchangeValue(piece.piece) > exchangeValue(attacker.piece) ||
+		len(attackers(game, target, piece.color)) == 0
+}
+
+// threatenedBy lists the enemy pieces the piece on p threatens, the most
+// valuable first.
+func threatenedBy(game *Game, p Position) []Position {
+	var result []Position
+	for _, square := range attackedSquares(game, &p) {
+		if threatened(game, p, square) {
+			result = append(result, square)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return exchangeValue(game.placement[result[i].x][result[i].y].piece) > exchangeValue(game.placement[result[j].x][result[j].y].piece)
+	})
+	return result
+}
+
+// positionTactics finds the motifs on the board: the forks, pins and
+// skewers of both colors, and a double check or mate of the side to move.
+// Discovered attacks and the removal of a defender are made by a move, they
+// are only found by moveTactics.
+func positionTactics(game *Game) []tactic {
+	var result []tactic = []tactic{}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if game.placement[x][y].piece == 0 {
+				continue
+			}
+			var p Position = Position{x, y}
+			if targets := threatenedBy(game, p); len(targets) >= 2 {
+				result = append(result, newTactic(game, motifFork, p, targets...))
+			}
+			result = append(result, lineTactics(game, p)...)
+		}
+	}
+
+	var king Position = findKing(game, game.color)
+	if game.placement[king.x][king.y].piece != King {
+		return result
+	}
+	var checkers []Position = attackers(game, king, flipColor(game.color))
+	if len(checkers) >= 2 {
+		result = append(result, newTactic(game, motifDoubleCheck, checkers[0], king))
+	}
+	if len(checkers) > 0 && len(legalMoves(game, game.color)) == 0 {
+		result = append(result, newTactic(game, motifCheckmate, checkers[0], king))
+		if motif := matePattern(game, king, checkers); motif != "" {
+			result = append(result, newTactic(game, motif, checkers[0], king))
+		}
+	}
+	return result
+}
+
+// moveTactics finds the motifs a legal move creates, and searches the
+// position after it to tell whether it wins material.
+func moveTactics(game *Game, move Move) tacticsReport {
+	var color PieceColor = game.color
+	var enemy PieceColor = flipColor(color)
+	var next Game = makeMove(*game, move)
+	var report tacticsReport = tacticsReport{Fen: toFen(game), Move: moveToUci(move), San: moveToSan(game, move), Tactics: []tactic{}}
+
+	var add = func(t tactic) {
+		report.Tactics = append(report.Tactics, t)
+	}
+
+	var king Position = findKing(&next, enemy)
+	var checkers []Position = attackers(&next, king, color)
+
+	if len(checkers) >= 2 {
+		add(newTactic(&next, motifDoubleCheck, move.p1, king))
+	}
+	if !isCastling(game, move) {
+		for _, checker := range checkers {
+			if checker != move.p1 {
+				add(newTactic(&next, motifDiscoveredCheck, checker, king))
+			}
+		}
+	}
+
+	if targets := threatenedBy(&next, move.p1); len(targets) >= 2 {
+		add(newTactic(&next, motifFork, move.p1, targets...))
+	}
+	for _, t := range lineTactics(&next, move.p1) {
+		add(t)
+	}
+
+	//pieces that attack through the square the move left
+	for _, p := range getPieces(&next, color) {
+		if p == move.p1 || next.placement[p.x][p.y].piece == 0 || isCastling(game, move) {
+			continue
+		}
+
+		var before []Position = attackedSquares(game, &p)
+		var targets []Position
+		for _, target := range threatenedBy(&next, p) {
+			if next.placement[target.x][target.y].piece != King && !containsPosition(before, target) {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) > 0 {
+			add(newTactic(&next, motifDiscoveredAttack, p, targets...))
+		}
+	}
+
+	//a captured defender leaves what it defended en prise
+	var captured Piece = game.placement[move.p1.x][move.p1.y]
+	if captured.piece != 0 {
+		var targets []Position
+		for _, square := range attackedSquares(game, &move.p1) {
+			var piece Piece = next.placement[square.x][square.y]
+			if piece.piece != 0 && piece.piece != King && piece.color == enemy && see(game, square, color) <= 0 && see(&next, square, color) > 0 {
+				targets = append(targets, square)
+			}
+		}
+		if len(targets) > 0 {
+			add(newTactic(&next, motifRemovalOfDefender, move.p1, targets...))
+		}
+	}
+
+	var mate bool = len(checkers) > 0 && len(legalMoves(&next, enemy)) == 0
+	if mate {
+		add(newTactic(&next, motifCheckmate, checkers[0], king))
+		if motif := matePattern(&next, king, checkers); motif != "" {
+			add(newTactic(&next, motif, checkers[0], king))
+		}
+		report.Sound = true
+		return report
+	}
+
+	//the material the move wins is counted at the end of the line the
+	//search expects, captures included
+	var s search = search{quiesce: true}
+	var pv []Move
+	var score int = -s.alphaBetaPruning(&next, tacticDepth, 1, -infinity, infinity, &pv)
+	var end Game = next
+	for _, move := range pv {
+		end = makeMove(end, move)
+	}
+	report.Gain = materialBalance(&end, color) - materialBalance(game, color)
+	report.Sound = score > mateBound || report.Gain >= tacticMargin
+	return report
+}
+
+// materialBalance is the material of color minus that of its opponent.
+func materialBalance(game *Game, color PieceColor) int {
+	return sideMaterial(game, color) - sideMaterial(game, flipColor(color))
+}
+
+// matePattern names the kind of a checkmate, or returns "".
+func matePattern(game *Game, king Position, checkers []Position) string {
+	var color PieceColor = game.placement[king.x][king.y].color
+	var checker Piece = game.placement[checkers[0].x][checkers[0].y]
+
+	//every square around the king is taken by its own pieces
+	var smothered bool = true
+	for _, square := range attackedSquares(game, &king) {
+		if game.placement[square.x][square.y].piece == 0 || game.placement[square.x][square.y].color != color {
+			smothered = false
+		}
+	}
+	if len(checkers) == 1 && checker.piece == Knight && smothered {
+		return motifSmotheredMate
+	}
+
+	var home, forward int = 7, -1
+	if color == Black {
+		home, forward = 0, 1
+	}
+	if king.y != home || checkers[0].y != home || (checker.piece != Rook && checker.piece != Queen) {
+		return ""
+	}
+
+	//the king's own pieces keep it on the back rank
+	for x := max(king.x-1, 0); x <= min(king.x+1, 7); x++ {
+		var square Piece = game.placement[x][home+forward]
+		if square.piece == 0 || square.color != color {
+			return ""
+		}
+	}
+	return motifBackRankMate
+}
+
+func containsPosition(positions []Position, p Position) bool {
+	for _, position := range positions {
+		if position == p {
+			return true
+		}
+	}
+	return false
+}
+
+// tacticsJson labels the tactics of a fen as JSON: those a move creates if
+// move is not empty, otherwise those on the board, see positionTactics.
+func tacticsJson(fen string, move string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	var report tacticsReport = tacticsReport{Fen: toFen(&game), Tactics: positionTactics(&game)}
+	if move != "" {
+		parsed, err := parseMove(&game, move)
+		if err != nil {
+			return "", err
+		}
+		report = moveTactics(&game, parsed)
+	}
+
+	data, err := json.Marshal(report)
+	return string(data), err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPositionTactics(t *testing.T) {
+	var tests = []struct {
+		name    string
+		fen     string
+		motif   string
+		square  string
+		targets []string
+	}{
+		{"pawn pinned to its king", "4k3/3p4/8/1B6/8/8/8/4K3 b - - 0 1", motifAbsolutePin, "b5", []string{"d7"}},
+		{"knight pinned to its king", "4k3/3n4/8/1B6/8/8/8/4K3 b - - 0 1", motifAbsolutePin, "b5", []string{"d7"}},
+		{"knight pinned to the queen", "3qk3/8/3n4/8/8/8/8/3RK3 b - - 0 1", motifRelativePin, "d1", []string{"d6", "d8"}},
+		{"fork on the board", "r3k3/2N5/8/8/8/8/8/4K3 b - - 0 1", motifFork, "c7", []string{"e8", "a8"}},
+		{"back rank mate", "R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1", motifBackRankMate, "a8", []string{"g8"}},
+	}
+
+	for _, test := range tests {
+		var fen string = test.fen
+		game, err := loadFen(&fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var found bool = false
+		for _, tactic := range positionTactics(&game) {
+			if tactic.Motif == test.motif && tactic.Square == test.square && equalStrings(tactic.Targets, test.targets) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no %s of %s on %v in %v", test.name, test.motif, test.square, test.targets, positionTactics(&game))
+		}
+	}
+
+	//a pawn in front of a rook is not worth a relative pin
+	var fen string = "3r3k/8/8/8/8/8/3p4/3Q3K w - - 0 1"
+	game, _ := loadFen(&fen)
+	if tactics := positionTactics(&game); len(tactics) != 0 {
+		t.Errorf("pawn in front of a rook: %v", tactics)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,368 @@
+//go:build !js
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Retrograde tablebase generation. Every position of a table is first
+// examined with the engine's move generator: mates, stalemates and moves
+// that leave the table (captures and promotions, resolved by probing the
+// smaller tables) are settled right away. Results are then propagated
+// backwards one ply at a time by un-making moves, until every remaining
+// position is known to be a draw.
+//
+// Positions reached by a double pawn push are stored without the en passant
+// square, so an en passant capture right after it is not considered.
+
+func tbgenCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("tbgen", flag.ExitOnError)
+	var dir *string = flags.String("dir", ".", "directory for the table files")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("tbgen: no material given, e.g. tbgen -dir tb KQK KRK KPK KRKP")
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	for _, key := range flags.Args() {
+		if err := generateTablebase(strings.ToUpper(key), *dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTablebaseDir registers every table file found in dir.
+func loadTablebaseDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tb"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tb, err := parseTablebase(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		registerTablebase(tb)
+	}
+
+	return nil
+}
+
+// canonicalTablebaseKey orders each side's pieces and puts the side with
+// more material first, so that "KKR" and "KRK" share a table.
+func canonicalTablebaseKey(key string) (string, error) {
+	white, black, err := splitMaterialKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	var order string = "KQRBNP"
+	var sortSide = func(side string) string {
+		var letters []byte = []byte(side)
+		sort.Slice(letters, func(i, j int) bool {
+			return strings.IndexByte(order, letters[i]) < strings.IndexByte(order, letters[j])
+		})
+		return string(letters)
+	}
+	var strength = func(side string) int {
+		var values map[rune]int = map[rune]int{'Q': 9, 'R': 5, 'B': 3, 'N': 3, 'P': 1}
+		var sum int = 0
+		for _, letter := range side {
+			sum += values[letter]
+		}
+		return sum
+	}
+
+	white, black = sortSide(white), sortSide(black)
+	if strength(black) > strength(white) || (strength(black) == strength(white) && black < white) {
+		white, black = black, white
+	}
+
+	return white + black, nil
+}
+
+// tablebaseDependencies lists the tables reached by captures and promotions.
+func tablebaseDependencies(key string) []string {
+	white, black, _ := splitMaterialKey(key)
+	var keys []string
+
+	var add = func(white, black string) {
+		if len(white)+len(black) <= 2 {
+			return
+		}
+		canonical, _ := canonicalTablebaseKey(white + black)
+		for _, k := range keys {
+			if k == canonical {
+				return
+			}
+		}
+		keys = append(keys, canonical)
+	}
+
+	for i := 1; i < len(white); i++ {
+		add(white[:i]+white[i+1:], black)
+		if white[i] == 'P' {
+			for _, promotion := range "QRBN" {
+				add(white[:i]+string(promotion)+white[i+1:], black)
+			}
+		}
+	}
+	for i := 1; i < len(black); i++ {
+		add(white, black[:i]+black[i+1:])
+		if black[i] == 'P' {
+			for _, promotion := range "QRBN" {
+				add(white, black[:i]+string(promotion)+black[i+1:])
+			}
+		}
+	}
+
+	return keys
+}
+
+// generateTablebase loads the table for key from dir, or generates it
+// along with every table it depends on.
+func generateTablebase(key string, dir string) error {
+	key, err := canonicalTablebaseKey(key)
+	if err != nil {
+		return err
+	}
+	if len(key) <= 2 || findTablebase(key) != nil {
+		return nil
+	}
+
+	var path string = filepath.Join(dir, key+".tb")
+	if data, err := os.ReadFile(path); err == nil {
+		tb, err := parseTablebase(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		registerTablebase(tb)
+		return nil
+	}
+
+	for _, dependency := range tablebaseDependencies(key) {
+		if err := generateTablebase(dependency, dir); err != nil {
+			return err
+		}
+	}
+
+	tb, err := newTablebase(key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "generating", key, "entries:", tb.size())
+
+	tb.data, err = retrograde(tb)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeTablebase(tb)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	registerTablebase(tb)
+	fmt.Fprintln(os.Stderr, "wrote", path, "bytes:", len(data))
+
+	return nil
+}
+
+const (
+	tbUnknown = iota
+	tbInvalid
+	tbResolved
+)
+
+func retrograde(tb *tablebase) ([]byte, error) {
+	var size int = tb.size()
+	var values []byte = make([]byte, size)
+	var state []byte = make([]byte, size)
+	var remaining []byte = make([]byte, size) //moves that stay in the table and are not known to lose
+	var exitWin []byte = make([]byte, size)   //fastest win through a capture or promotion
+	var exitLoss []byte = make([]byte, size)  //slowest loss through a capture or promotion
+	var exitDraw []bool = make([]bool, size)
+
+	var pendingWin, pendingLoss [256][]int32
+
+	for index := 0; index < size; index++ {
+		squares, whiteToMove := tb.decode(index)
+		game, ok := tb.game(squares, whiteToMove)
+		if !ok {
+			state[index] = tbInvalid
+			continue
+		}
+
+		var moves []Move = legalMoves(&game, game.color)
+		if len(moves) == 0 {
+			if inCheck(game, game.color) { //checkmate
+				pendingLoss[0] = append(pendingLoss[0], int32(index))
+			} else { //stalemate
+				state[index] = tbResolved
+			}
+			continue
+		}
+
+		for _, move := range moves {
+			if game.placement[move.p1.x][move.p1.y].piece == 0 && move.promotion == 0 && !isEnPassant(&game, move) {
+				remaining[index]++
+				continue
+			}
+
+			var child Game = makeMove(game, move)
+			value, ok := exitValue(&child)
+			if !ok {
+				return nil, errors.New("missing tablebase for " + materialKey(&child))
+			}
+
+			if value == 0 {
+				exitDraw[index] = true
+			} else if value >= 128 { //the opponent gets mated
+				var plies byte = value - 128 + 1
+				if exitWin[index] == 0 || plies < exitWin[index] {
+					exitWin[index] = plies
+				}
+			} else {
+				exitLoss[index] = max(exitLoss[index], value+1)
+			}
+		}
+
+		if exitWin[index] != 0 {
+			pendingWin[exitWin[index]] = append(pendingWin[exitWin[index]], int32(index))
+		} else if remaining[index] == 0 && !exitDraw[index] {
+			pendingLoss[exitLoss[index]] = append(pendingLoss[exitLoss[index]], int32(index))
+		}
+	}
+
+	for ply := 0; ply < 256; ply++ {
+		var frontier []int32
+
+		for _, index := range pendingWin[ply] {
+			if state[index] == tbUnknown {
+				state[index] = tbResolved
+				values[index] = byte(ply)
+				frontier = append(frontier, index)
+			}
+		}
+		for _, index := range pendingLoss[ply] {
+			if state[index] == tbUnknown {
+				state[index] = tbResolved
+				values[index] = byte(128 + ply)
+				frontier = append(frontier, index)
+			}
+		}
+		pendingWin[ply], pendingLoss[ply] = nil, nil
+
+		if len(frontier) > 0 && ply >= 127 {
+			return nil, errors.New("distance to mate too long for " + tb.key)
+		}
+
+		for _, index := range frontier {
+			var lost bool = values[index] >= 128
+			for _, previous := range tb.predecessors(int(index)) {
+				if state[previous] != tbUnknown {
+					continue
+				}
+				if lost {
+					pendingWin[ply+1] = append(pendingWin[ply+1], int32(previous))
+					continue
+				}
+
+				remaining[previous]--
+				if remaining[previous] == 0 && exitWin[previous] == 0 && !exitDraw[previous] {
+					var at int = max(ply+1, int(exitLoss[previous]))
+					pendingLoss[at] = append(pendingLoss[at], int32(previous))
+				}
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func isEnPassant(game *Game, move Move) bool {
+	return game.placement[move.p0.x][move.p0.y].piece == Pawn && move.p0.x != move.p1.x
+}
+
+// exitValue probes the table a capture or promotion leads to.
+func exitValue(game *Game) (byte, bool) {
+	white, black := materialKeys(game)
+	if white == "K" && black == "K" {
+		return 0, true
+	}
+	return probeTablebaseValue(game)
+}
+
+// predecessors lists the entries from which the side that just moved could
+// have reached this one without a capture or promotion.
+func (tb *tablebase) predecessors(index int) []int {
+	squares, whiteToMove := tb.decode(index)
+	game, _ := tb.game(squares, whiteToMove)
+	var mover PieceColor = flipColor(game.color)
+	var previous []int
+
+	var add = func(slot int, from Position) {
+		var tmp []Position = make([]Position, len(squares))
+		copy(tmp, squares)
+		tmp[slot] = from
+		previous = append(previous, tb.index(tmp, mover == White))
+	}
+
+	for slot, p := range squares {
+		var piece Piece = tb.pieces[slot]
+		if piece.color != mover {
+			continue
+		}
+
+		if piece.piece != Pawn {
+			for _, from := range attackedSquares(&game, &p) {
+				if game.placement[from.x][from.y].piece == 0 {
+					add(slot, from)
+				}
+			}
+			continue
+		}
+
+		var back int = 1 //white pawns came from below
+		var start int = 6
+		if piece.color == Black {
+			back = -1
+			start = 1
+		}
+
+		var from Position = Position{p.x, p.y + back}
+		if from.y == 0 || from.y == 7 || game.placement[from.x][from.y].piece != 0 {
+			continue
+		}
+		add(slot, from)
+
+		var double Position = Position{p.x, p.y + 2*back}
+		if double.y == start && game.placement[double.x][double.y].piece == 0 {
+			add(slot, double)
+		}
+	}
+
+	return previous
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// The threats of a position: how often both colors attack every square,
+// the pieces that can be won by capturing them and the pieces pinned to
+// their king. Meant for a "show threats" overlay and for warning about a
+// blunder before a move is played.
+
+type threatMap struct {
+	Fen     string          `json:"fen"`
+	Squares []squareControl `json:"squares"` //a8 to h1, in fen order
+	Hanging []hangingPiece  `json:"hanging"`
+	Pinned  []pinnedPiece   `json:"pinned"`
+}
+
+type squareControl struct {
+	Square string `json:"square"`
+	Piece  string `json:"piece,omitempty"` //upper case for white
+	White  int    `json:"white"`           //white pieces attacking or defending the square
+	Black  int    `json:"black"`
+}
+
+// hangingPiece is a piece the enemy wins material by capturing, by static
+// exchange evaluation.
+type hangingPiece struct {
+	Square    string `json:"square"`
+	Piece     string `json:"piece"`
+	Attackers int    `json:"attackers"`
+	Defenders int    `json:"defenders"`
+	Loss      int    `json:"loss"` //centipawns lost if the enemy takes
+}
+
+// pinnedPiece cannot leave the line between its king and the pinning piece.
+type pinnedPiece struct {
+	Square string `json:"square"`
+	Piece  string `json:"piece"`
+	By     string `json:"by"` //the square of the pinning piece
+}
+
+func threats(game *Game) threatMap {
+	var result threatMap = threatMap{Fen: toFen(game), Squares: []squareControl{}, Hanging: []hangingPiece{}, Pinned: []pinnedPiece{}}
+	var control [2][8][8]int = [2][8][8]int{getControl(game, Black), getControl(game, White)}
+
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var piece Piece = game.placement[x][y]
+			var square squareControl = squareControl{Square: squareName(Position{x, y}), White: control[White][x][y], Black: control[Black][x][y]}
+			if piece.piece != 0 {
+				square.Piece = pieceCode(piece)
+			}
+			result.Squares = append(result.Squares, square)
+
+			if piece.piece == 0 || piece.piece == King {
+				continue
+			}
+
+			var enemy PieceColor = flipColor(piece.color)
+			if control[enemy][x][y] == 0 {
+				continue
+			}
+			if loss := see(game, Position{x, y}, enemy); loss > 0 {
+				result.Hanging = append(result.Hanging, hangingPiece{
+					Square:    square.Square,
+					Piece:     square.Piece,
+					Attackers: control[enemy][x][y],
+					Defenders: control[piece.color][x][y],
+					Loss:      loss,
+				})
+			}
+		}
+	}
+
+	for _, color := range [2]PieceColor{White, Black} {
+		for _, pin := range pins(game, color) {
+			result.Pinned = append(result.Pinned, pinnedPiece{
+				Square: squareName(pin[0]),
+				Piece:  pieceCode(game.placement[pin[0].x][pin[0].y]),
+				By:     squareName(pin[1]),
+			})
+		}
+	}
+
+	return result
+}
+
+// exchangeValue is the value of a piece in exchanges. The king is never
+// captured, so it only needs to outweigh everything else.
+func exchangeValue(piece PieceType) int {
+	if piece == King {
+		return 100000
+	}
+	return pieceValue(piece)
+}
+
+// see is the static exchange evaluation of square: the material color wins
+// by starting to capture on it, with both sides always recapturing with
+// their least valuable piece and stopping when that loses. Pieces behind
+// others on a line join in once those are gone. 0 if color cannot capture.
+func see(game *Game, square Position, color PieceColor) int {
+	var board Game = *game
+	var gains []int = []int{exchangeValue(board.placement[square.x][square.y].piece)}
+	var side PieceColor = color
+
+	for {
+		var from Position
+		var found bool = false
+		for _, p := range attackers(&board, square, side) {
+			if !found || exchangeValue(board.placement[p.x][p.y].piece) < exchangeValue(board.placement[from.x][from.y].piece) {
+				from, found = p, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		var piece Piece = board.placement[from.x][from.y]
+		board.placement[square.x][square.y] = piece
+		board.placement[from.x][from.y] = Piece{}
+
+		//the king cannot capture a defended piece
+		if piece.piece == King && len(attackers(&board, square, flipColor(side))) > 0 {
+			break
+		}
+
+		gains = append(gains, exchangeValue(piece.piece)-gains[len(gains)-1])
+		side = flipColor(side)
+	}
+
+	if len(gains) == 1 {
+		return 0
+	}
+
+	//gains[i] is the balance if the exchange stops after capture i, each
+	//side stops when going on loses
+	for i := len(gains) - 2; i > 0; i-- {
+		gains[i-1] = -max(-gains[i-1], gains[i])
+	}
+	return gains[0]
+}
+
+// pins returns the pieces of color pinned to their king, each with the
+// square of the pinning piece.
+func pins(game *Game, color PieceColor) [][2]Position {
+	var king Position = findKing(game, color)
+	var result [][2]Position
+
+	if game.placement[king.x][king.y].piece != King {
+		return result
+	}
+
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			var diagonal bool = dx != 0 && dy != 0
+
+			var pinned *Position
+			for x, y := king.x+dx, king.y+dy; x >= 0 && x < 8 && y >= 0 && y < 8; x, y = x+dx, y+dy {
+				var piece Piece = game.placement[x][y]
+				if piece.piece == 0 {
+					continue
+				}
+				if piece.color == color {
+					if pinned != nil {
+						break
+					}
+					pinned = &Position{x, y}
+					continue
+				}
+
+				var slides bool = piece.piece == Queen || (diagonal && piece.piece == Bishop) || (!diagonal && piece.piece == Rook)
+				if pinned != nil && slides {
+					result = append(result, [2]Position{*pinned, {x, y}})
+				}
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// threatsJson is threats of a fen as JSON, after move if it is not empty,
+// so that a move can be checked before it is played.
+func threatsJson(fen string, move string) (string, error) {
+	game, err := loadFen(&fen)
+	if err != nil {
+		return "", err
+	}
+
+	if move != "" {
+		parsed, err := parseMove(&game, move)
+		if err != nil {
+			return "", err
+		}
+		game = makeMove(game, parsed)
+	}
+
+	data, err := json.Marshal(threats(&game))
+	return string(data), err
+}
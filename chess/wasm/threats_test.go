@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSee(t *testing.T) {
+	var pawn, knight, rook, queen int = pieceValue(Pawn), pieceValue(Knight), pieceValue(Rook), pieceValue(Queen)
+
+	var tests = []struct {
+		name   string
+		fen    string
+		square string
+		want   int //for white
+	}{
+		{"undefended pawn", "1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e5", pawn},
+		{"defended pawn", "4k3/8/3p4/4p3/8/8/8/4RK2 w - - 0 1", "e5", pawn - rook},
+		{"hanging queen", "4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1", "d5", queen},
+		{"no attacker", "4k3/8/8/3q4/8/8/8/4K3 w - - 0 1", "d5", 0},
+		{"rooks behind each other", "4k3/4r3/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e5", pawn},
+		{"x-rays on both sides", "1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "e5", pawn - knight},
+		{"king takes a defended pawn", "4k3/8/3p4/4p3/3K4/8/8/8 w - - 0 1", "e5", 0},
+	}
+
+	for _, test := range tests {
+		var fen string = test.fen
+		game, err := loadFen(&fen)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		square, _ := parseSquare(test.square)
+		if got := see(&game, square, White); got != test.want {
+			t.Errorf("%s: see %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+// The transposition table remembers the results of searched positions, by
+// Polyglot key, so that they are not searched again when they come up
+// through another move order or in the next search of a session.
+
+const (
+	exactBound = iota + 1
+	lowerBound //the score is at least this, the search failed high
+	upperBound //the score is at most this, the search failed low
+)
+
+type ttEntry struct {
+	key   uint64
+	move  Move
+	score int32
+	depth int8
+	bound uint8 //0 for an empty entry
+}
+
+type transpositionTable struct {
+	entries []ttEntry
+}
+
+const ttEntryBytes = 64 //about the size of an entry, for sizing tables
+
+// newTranspositionTable allocates a table of at most megabytes.
+func newTranspositionTable(megabytes int) *transpositionTable {
+	var count int = 1
+	for count*2*ttEntryBytes <= max(megabytes, 1)<<20 {
+		count *= 2
+	}
+	return &transpositionTable{entries: make([]ttEntry, count)}
+}
+
+func (t *transpositionTable) clear() {
+	clear(t.entries)
+}
+
+// hashfull estimates the permille of the table in use from its first
+// entries.
+func (t *transpositionTable) hashfull() int {
+	var sample int = min(len(t.entries), 1000)
+	var used int = 0
+	for _, entry := range t.entries[:sample] {
+		if entry.bound != 0 {
+			used++
+		}
+	}
+	return used * 1000 / sample
+}
+
+func (t *transpositionTable) probe(key uint64) (ttEntry, bool) {
+	var entry ttEntry = t.entries[key&uint64(len(t.entries)-1)]
+	return entry, entry.bound != 0 && entry.key == key
+}
+
+// store replaces what the slot holds, unless it is a deeper result of the
+// same position: a slot taken by another position always goes to the newer
+// one, so that the table follows the game instead of filling up with old
+// deep entries. Mate scores are stored relative to the position instead of
+// the root.
+func (t *transpositionTable) store(key uint64, depth, ply int, score int, bound uint8, move Move) {
+	var entry *ttEntry = &t.entries[key&uint64(len(t.entries)-1)]
+	if entry.bound != 0 && entry.key == key && int(entry.depth) > depth {
+		return
+	}
+
+	if score > mateBound {
+		score += ply
+	} else if score < -mateBound {
+		score -= ply
+	}
+
+	*entry = ttEntry{key: key, move: move, score: int32(score), depth: int8(min(depth, 127)), bound: bound}
+}
+
+// value is the stored score with mates counted from the root again.
+func (e ttEntry) value(ply int) int {
+	var score int = int(e.score)
+	if score > mateBound {
+		return score - ply
+	} else if score < -mateBound {
+		return score + ply
+	}
+	return score
+}
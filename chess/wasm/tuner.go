@@ -0,0 +1,393 @@
+//go:build !js
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Texel tuning: every evaluation parameter is adjusted until the static
+// evaluation of a set of quiet, result-labeled positions predicts the game
+// results as closely as possible.
+//
+//	E = 1/N * sum((result - sigmoid(eval))^2)
+//	sigmoid(s) = 1 / (1 + 10^(-K*s/400))
+
+type tuningPosition struct {
+	game   Game
+	result float64 //1 white won, 0.5 draw, 0 black won
+}
+
+func tuneCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("tune", flag.ExitOnError)
+	var in *string = flags.String("in", "", "labeled positions (EPD) or games (.pgn), comma separated")
+	var out *string = flags.String("out", "params.json", "output file (.json or .go)")
+	var passes *int = flags.Int("passes", 100, "maximum number of passes over all parameters")
+	var limit *int = flags.Int("limit", 0, "use at most this many positions (0 for all)")
+	flags.Parse(args)
+
+	if *in == "" {
+		return errors.New("tune: -in is required")
+	}
+
+	var positions []tuningPosition
+	for _, path := range strings.Split(*in, ",") {
+		var read func(path string, limit int) ([]tuningPosition, error) = readLabeledPositions
+		if strings.HasSuffix(strings.ToLower(path), ".pgn") {
+			read = readPgnPositions
+		}
+		tmp, err := read(path, *limit-len(positions))
+		if err != nil {
+			return err
+		}
+		positions = append(positions, tmp...)
+		if *limit > 0 && len(positions) >= *limit {
+			break
+		}
+	}
+
+	if len(positions) == 0 {
+		return errors.New("tune: no labeled positions found")
+	}
+
+	fmt.Fprintln(os.Stderr, "positions:", len(positions))
+
+	var k float64 = tuneK(positions)
+	fmt.Fprintf(os.Stderr, "k: %.4f\n", k)
+
+	var values []*int = params.values()
+	var names []string = params.names()
+	var bestError float64 = tuningError(positions, k)
+	fmt.Fprintf(os.Stderr, "initial error: %.6f\n", bestError)
+
+	for pass := 1; pass <= *passes; pass++ {
+		var improved bool = false
+
+		for i := 0; i < len(values); i++ {
+			for _, step := range []int{1, -1} {
+				*values[i] += step
+				var e float64 = tuningError(positions, k)
+				if e < bestError {
+					bestError = e
+					improved = true
+
+					//keep walking in the same direction while it helps
+					for {
+						*values[i] += step
+						e = tuningError(positions, k)
+						if e >= bestError {
+							*values[i] -= step
+							break
+						}
+						bestError = e
+					}
+					break
+				}
+				*values[i] -= step
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "pass: %d error: %.6f\n", pass, bestError)
+
+		if err := saveParamsFile(*out, &params); err != nil {
+			return err
+		}
+
+		if !improved {
+			break
+		}
+	}
+
+	for i := 0; i < len(values); i++ {
+		fmt.Println(names[i], *values[i])
+	}
+
+	return nil
+}
+
+// readLabeledPositions reads one position per line. The result label can be
+// an EPD c9 opcode (c9 "1-0";), a bracketed score ([1.0], [0.5], [0.0]) or a
+// bare result token at the end of the line.
+func readLabeledPositions(path string, limit int) ([]tuningPosition, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var positions []tuningPosition
+	var scanner *bufio.Scanner = bufio.NewScanner(file)
+	var line int = 0
+
+	for scanner.Scan() {
+		line++
+		var text string = strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fen, result, err := parseLabeledLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		game, err := loadFen(&fen)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		positions = append(positions, tuningPosition{game, result})
+
+		if limit > 0 && len(positions) >= limit {
+			break
+		}
+	}
+
+	return positions, scanner.Err()
+}
+
+// pgnOpeningPlies are skipped at the start of every game, they are mostly
+// book moves.
+const pgnOpeningPlies = 8
+
+var errLimitReached error = errors.New("limit reached")
+
+// readPgnPositions labels the quiet positions of finished games with the
+// game's result: positions not in check whose next move is no capture or
+// promotion, from pgnOpeningPlies on. Games that cannot be replayed are
+// reported and skipped.
+func readPgnPositions(path string, limit int) ([]tuningPosition, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var positions []tuningPosition
+	var games int = 0
+
+	err = readPgn(file, func(pgn *pgnGame) error {
+		games++
+		var result float64
+		switch pgn.result {
+		case "1-0":
+			result = 1
+		case "0-1":
+			result = 0
+		case "1/2-1/2":
+			result = 0.5
+		default:
+			return nil
+		}
+
+		game, err := pgn.start()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: game %d: %v\n", path, games, err)
+			return nil
+		}
+
+		var labeled []tuningPosition
+		for ply, san := range pgn.moves {
+			move, err := parseSan(&game, san)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: game %d: %v\n", path, games, err)
+				return nil
+			}
+
+			var pawn bool = game.placement[move.p0.x][move.p0.y].piece == Pawn
+			var capture bool = game.placement[move.p1.x][move.p1.y].piece != 0 || (pawn && move.p0.x != move.p1.x)
+			if ply >= pgnOpeningPlies && !inCheck(game, game.color) && !capture && move.promotion == 0 {
+				labeled = append(labeled, tuningPosition{game, result})
+			}
+			game = makeMove(game, move)
+		}
+
+		positions = append(positions, labeled...)
+		if limit > 0 && len(positions) >= limit {
+			positions = positions[:limit]
+			return errLimitReached
+		}
+		return nil
+	})
+
+	if errors.Is(err, errLimitReached) {
+		err = nil
+	}
+	return positions, err
+}
+
+func parseLabeledLine(text string) (string, float64, error) {
+	var fields []string = strings.Fields(text)
+	if len(fields) < 5 {
+		return "", 0, errors.New("invalid epd")
+	}
+
+	var fen string = strings.Join(fields[:4], " ")
+	var label string = strings.Join(fields[4:], " ")
+
+	if i := strings.Index(label, "c9"); i > -1 {
+		label = label[i+2:]
+	}
+	label = strings.Trim(label, " \";[]")
+	if i := strings.IndexAny(label, "\";"); i > -1 {
+		label = label[:i]
+	}
+	if fields := strings.Fields(label); len(fields) > 0 {
+		label = fields[len(fields)-1]
+	}
+
+	switch label {
+	case "1-0", "1.0", "1":
+		return fen, 1, nil
+	case "0-1", "0.0", "0":
+		return fen, 0, nil
+	case "1/2-1/2", "0.5", ".5":
+		return fen, 0.5, nil
+	}
+
+	return "", 0, fmt.Errorf("unknown result %q", label)
+}
+
+func sigmoid(score, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+// tuningError is the mean squared error between the game results and the
+// win probability predicted by the current parameters.
+func tuningError(positions []tuningPosition, k float64) float64 {
+	var workers int = runtime.NumCPU()
+	var sums []float64 = make([]float64, workers)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(positions); i += workers {
+				var e float64 = positions[i].result - sigmoid(float64(whiteScore(&positions[i].game)), k)
+				sums[w] += e * e
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var sum float64 = 0
+	for _, s := range sums {
+		sum += s
+	}
+
+	return sum / float64(len(positions))
+}
+
+// tuneK finds the scaling constant that best fits the current parameters,
+// so that the parameter search does not have to change the overall scale.
+func tuneK(positions []tuningPosition) float64 {
+	var start, end, step float64 = 0, 10, 1
+	var best float64 = tuningError(positions, start)
+	var k float64 = start
+
+	for i := 0; i < 10; i++ {
+		for c := start; c <= end; c += step {
+			var e float64 = tuningError(positions, c)
+			if e <= best {
+				best = e
+				k = c
+			}
+		}
+		start = k - step
+		end = k + step
+		step /= 10
+	}
+
+	return k
+}
+
+func loadParamsFile(path string) (EvalParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return EvalParams{}, err
+	}
+	return parseParams(data)
+}
+
+// saveParamsFile writes p as JSON, or as Go source when path ends in .go.
+// The Go form is a drop-in replacement for params_default.go.
+func saveParamsFile(path string, p *EvalParams) error {
+	var data []byte
+	var err error
+
+	if strings.HasSuffix(path, ".go") {
+		data, err = paramsSource(p)
+	} else {
+		data, err = json.MarshalIndent(p, "", "  ")
+		data = append(data, '\n')
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func paramsSource(p *EvalParams) ([]byte, error) {
+	var builder strings.Builder
+	builder.WriteString("package main\n\n")
+	builder.WriteString("// Default evaluation parameters.\n")
+	builder.WriteString("// Regenerate with: chess.exe tune -out params_default.go ...\n")
+	builder.WriteString("var defaultParams EvalParams = EvalParams{\n")
+
+	var value reflect.Value = reflect.ValueOf(*p)
+	for i := 0; i < value.NumField(); i++ {
+		builder.WriteString(value.Type().Field(i).Name)
+		builder.WriteString(": ")
+		builder.WriteString(value.Field(i).Type().String())
+		writeParamsArray(&builder, value.Field(i))
+		builder.WriteString(",\n")
+	}
+
+	builder.WriteString("}\n")
+
+	return format.Source([]byte(builder.String()))
+}
+
+// writeParamsArray writes the elements of an int array, or an array of int
+// arrays, as a composite literal. Piece-square tables get one rank per line.
+func writeParamsArray(builder *strings.Builder, value reflect.Value) {
+	builder.WriteString("{")
+
+	if value.Type().Elem().Kind() == reflect.Array {
+		builder.WriteString("\n")
+		for i := 0; i < value.Len(); i++ {
+			writeParamsArray(builder, value.Index(i))
+			builder.WriteString(",\n")
+		}
+	} else {
+		for i := 0; i < value.Len(); i++ {
+			if value.Len() == 64 && i%8 == 0 {
+				builder.WriteString("\n")
+			}
+			builder.WriteString(strconv.Itoa(int(value.Index(i).Int())))
+			if value.Len() == 64 || i < value.Len()-1 {
+				builder.WriteString(", ")
+			}
+		}
+		if value.Len() == 64 {
+			builder.WriteString("\n")
+		}
+	}
+
+	builder.WriteString("}")
+}
@@ -0,0 +1,349 @@
+//go:build !js
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The Universal Chess Interface. Commands are read from stdin, the search
+// runs in its own goroutine so that "stop", "isready" and "quit" are
+// answered while it thinks. An "xboard" command switches to CECP.
+
+const engineName = "Pro-test Chess"
+
+type uciEngine struct {
+	game    *GameSession
+	table   *transpositionTable //kept between the searches of a game
+	out     io.Writer
+	lines   int  //MultiPV
+	level   int  //Skill Level
+	elo     int  //UCI_Elo, played instead of the skill level while limit is set
+	limit   bool //UCI_LimitStrength
+	stop    atomic.Bool
+	running sync.WaitGroup
+	mutex   sync.Mutex //serializes output of the search goroutine and the loop
+}
+
+func uciCommand(args []string) error {
+	return runUci(os.Stdin, os.Stdout)
+}
+
+func runUci(in io.Reader, out io.Writer) error {
+	var engine *uciEngine = &uciEngine{out: out, lines: 1, level: skill, elo: 2500, table: newTranspositionTable(defaultHashSize)}
+	engine.newGame()
+
+	var scanner *bufio.Scanner = bufio.NewScanner(in)
+	for scanner.Scan() {
+		var fields []string = strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			engine.send("id name " + engineName)
+			engine.send("id author Pro-test")
+			engine.send("option name Skill Level type spin default 20 min 1 max 20")
+			engine.send("option name UCI_LimitStrength type check default false")
+			engine.send("option name UCI_Elo type spin default 2500 min 600 max 2500")
+			engine.send(fmt.Sprintf("option name Hash type spin default %d min 1 max %d", defaultHashSize, maxHashSize))
+			engine.send("option name MultiPV type spin default 1 min 1 max 64")
+			engine.send("option name OwnBook type check default true")
+			engine.send("option name Book File type string default <empty>")
+			engine.send("option name Tablebase Path type string default <empty>")
+			engine.send("option name Verbosity type spin default 1 min 0 max 2")
+			engine.send("uciok")
+		case "xboard": //the same executable speaks both protocols
+			return runCecp(scanner, out)
+		case "isready":
+			engine.send("readyok")
+		case "ucinewgame":
+			engine.wait()
+			engine.newGame()
+		case "position":
+			engine.wait()
+			if err := engine.position(fields[1:]); err != nil {
+				engine.send("info string " + err.Error())
+			}
+		case "go":
+			engine.wait()
+			engine.goSearch(fields[1:])
+		case "stop":
+			engine.wait()
+		case "setoption":
+			engine.wait()
+			if err := engine.setOption(fields[1:]); err != nil {
+				engine.send("info string " + err.Error())
+			}
+		case "quit":
+			engine.wait()
+			return nil
+		case "d": //not part of the protocol, handy when debugging
+			printPosition(engine.game.current())
+		default:
+			engine.send("info string unknown command " + fields[0])
+		}
+	}
+
+	engine.wait()
+	return scanner.Err()
+}
+
+func (e *uciEngine) send(line string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	fmt.Fprintln(e.out, line)
+}
+
+// wait stops a running search and waits for its bestmove.
+func (e *uciEngine) wait() {
+	e.stop.Store(true)
+	e.running.Wait()
+}
+
+// newGame starts over from the initial position and forgets what the
+// previous game taught the transposition table.
+func (e *uciEngine) newGame() {
+	e.game, _ = parseGameSession("startpos")
+	e.table.clear()
+}
+
+// position handles "startpos [moves ...]" and "fen <fen> [moves ...]". The
+// moves are kept for the repetition detection.
+func (e *uciEngine) position(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("position: missing startpos or fen")
+	}
+	if args[0] != "startpos" && args[0] != "fen" {
+		return fmt.Errorf("position: unknown %s", args[0])
+	}
+
+	game, err := parseGameSession(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	e.game = game
+	return nil
+}
+
+// strength is the skill level to play at, the one of UCI_Elo while
+// UCI_LimitStrength is on.
+func (e *uciEngine) strength() int {
+	if e.limit {
+		return skillForElo(e.elo)
+	}
+	return e.level
+}
+
+func (e *uciEngine) setOption(args []string) error {
+	//setoption name <id> [value <x>], the name may contain spaces
+	var text string = strings.Join(args, " ")
+	text = strings.TrimPrefix(text, "name ")
+	var name, value string = text, ""
+	if i := strings.Index(text, " value "); i > -1 {
+		name, value = text[:i], text[i+len(" value "):]
+	}
+
+	switch strings.ToLower(name) {
+	case "skill level":
+		level, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.level = min(max(level, 1), maxSkill)
+	case "uci_limitstrength":
+		e.limit = value == "true"
+	case "uci_elo":
+		elo, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.elo = elo
+	case "hash":
+		megabytes, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.table = newTranspositionTable(min(max(megabytes, 1), maxHashSize))
+	case "multipv":
+		lines, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		e.lines = max(lines, 1)
+	case "ownbook":
+		bookEnabled = value == "true"
+	case "book file":
+		if value == "" || value == "<empty>" {
+			book = nil
+			return nil
+		}
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return err
+		}
+		b, err := parseBook(data)
+		if err != nil {
+			return err
+		}
+		book = b
+	case "tablebase path":
+		if value != "" && value != "<empty>" {
+			return loadTablebaseDir(value)
+		}
+	case "verbosity":
+		level, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		verbosity = min(max(level, verbosityQuiet), verbosityMoves)
+	default:
+		return fmt.Errorf("unknown option %s", name)
+	}
+
+	return nil
+}
+
+// goSearch starts a search with the limits of a "go" command. Without any
+// limit, and with "infinite", it runs until "stop".
+func (e *uciEngine) goSearch(args []string) {
+	var game Game = *e.game.current()
+	var s *search = &search{stop: &e.stop, table: e.table, history: e.game.history(), start: time.Now()}
+	var depth int = maxSearchDepth
+	var infinite bool = false
+	var timeLeft, increment, movesToGo int = -1, 0, 0
+	var start time.Time = s.start
+
+	if verbosity >= verbosityMoves {
+		s.rootMove = func(depth int, move Move, number int) {
+			e.send(fmt.Sprintf("info depth %d currmove %s currmovenumber %d", depth, moveToUci(move), number))
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		var value int = 0
+		if i+1 < len(args) {
+			value, _ = strconv.Atoi(args[i+1])
+		}
+
+		switch args[i] {
+		case "depth":
+			depth = max(value, 1)
+		case "nodes":
+			s.nodeLimit = value
+		case "movetime":
+			s.deadline = start.Add(time.Duration(value) * time.Millisecond)
+		case "wtime", "btime":
+			if (args[i] == "wtime") == (game.color == White) {
+				timeLeft = value
+			}
+		case "winc", "binc":
+			if (args[i] == "winc") == (game.color == White) {
+				increment = value
+			}
+		case "movestogo":
+			movesToGo = value
+		case "infinite":
+			infinite = true
+			continue
+		default:
+			continue
+		}
+		i++ //skip the value
+	}
+
+	if timeLeft >= 0 {
+		s.deadline = start.Add(moveTime(timeLeft, increment, movesToGo))
+	}
+
+	var limited bool = depth < maxSearchDepth || s.nodeLimit > 0 || !s.deadline.IsZero()
+
+	//nothing to search when the game is over
+	if status := gameStatus(&game); status == "checkmate" || status == "stalemate" {
+		if status == "checkmate" {
+			e.send("info depth 0 score mate 0")
+		} else {
+			e.send("info depth 0 score cp 0")
+		}
+		e.send("bestmove 0000")
+		return
+	}
+
+	e.stop.Store(false)
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+
+		var best Move
+		if move, ok := bookMove(&game); ok {
+			best = move
+		} else if level := e.strength(); level < maxSkill {
+			line, _ := s.skillMove(&game, level)
+			best = line.move
+		} else {
+			var lines []searchLine = s.iterate(&game, depth, e.lines, func(depth int, lines []searchLine) {
+				if verbosity < verbosityIterations {
+					return
+				}
+				var info searchInfo = s.info(depth)
+				for i, line := range lines {
+					e.send(uciInfo(info, i+1, line))
+				}
+				e.send(fmt.Sprintf("info string tthits %d%% cutoffs %d firstmovecutoffs %d%%", info.TtHits, info.Cutoffs, info.FirstMoveCutoffs))
+			})
+			if len(lines) > 0 {
+				best = lines[0].move
+			}
+		}
+
+		//with "infinite", or without limits, bestmove waits for "stop"
+		if infinite || !limited {
+			for !e.stop.Load() {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		e.send("bestmove " + moveToUci(best))
+	}()
+}
+
+// moveTime is the time to spend on a move with timeLeft milliseconds left
+// on the clock.
+func moveTime(timeLeft, increment, movesToGo int) time.Duration {
+	if movesToGo <= 0 {
+		movesToGo = 30
+	}
+
+	var budget int = timeLeft/movesToGo + increment*3/4
+	budget = min(budget, timeLeft/2)
+	budget = max(budget-20, 1) //communication overhead
+
+	return time.Duration(budget) * time.Millisecond
+}
+
+func uciInfo(info searchInfo, multipv int, line searchLine) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "info depth %d seldepth %d multipv %d score ", info.Depth, info.SelDepth, multipv)
+	if line.Mate != 0 {
+		fmt.Fprintf(&builder, "mate %d", line.Mate)
+	} else {
+		fmt.Fprintf(&builder, "cp %d", line.Score)
+	}
+	fmt.Fprintf(&builder, " nodes %d nps %d hashfull %d time %d pv", info.Nodes, info.Nps, info.Hashfull, info.Time)
+	for _, move := range line.pv {
+		builder.WriteString(" " + moveToUci(move))
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Win, draw and loss probabilities of a search score, for users who find
+// centipawns hard to read. From the side to move's point of view a score x
+// wins with 1/(1+exp((a-x)/b)) and loses with 1/(1+exp((a+x)/b)), the rest
+// is a draw. a, the score at which winning becomes as likely as not, and b,
+// how fast the chances grow, are cubic polynomials of the material on the
+// board, the evaluation phase scaled to 0 (pawns only) to 1 (all pieces).
+// The native wdlfit command fits them to self-play games.
+
+type wdlModel struct {
+	A [4]float64 `json:"a"` //coefficients of a, the constant first
+	B [4]float64 `json:"b"`
+}
+
+// fitted with: chess.exe wdlfit -games 300 -nodes 3000
+var defaultWdl wdlModel = wdlModel{
+	A: [4]float64{298.77, -576.44, 280.28, 39.31},
+	B: [4]float64{150.81, 564.89, -722.44, 528.06},
+}
+
+var wdlParams wdlModel = defaultWdl
+
+// wdl is in per mille, the three always add up to 1000.
+type wdl struct {
+	Win  int `json:"win"`
+	Draw int `json:"draw"`
+	Loss int `json:"loss"`
+}
+
+// coefficients are a and b for a phase. a is kept from going negative, or
+// winning and losing would add up to more than 1.
+func (m *wdlModel) coefficients(phase int) (float64, float64) {
+	var x float64 = float64(min(max(phase, 0), maxPhase)) / maxPhase
+	var a, b float64 = 0, 0
+	for i := 3; i >= 0; i-- {
+		a = a*x + m.A[i]
+		b = b*x + m.B[i]
+	}
+	return max(a, 0), max(b, 1)
+}
+
+func (m *wdlModel) probabilities(score int, phase int) (float64, float64, float64) {
+	a, b := m.coefficients(phase)
+	var win float64 = 1 / (1 + math.Exp((a-float64(score))/b))
+	var loss float64 = 1 / (1 + math.Exp((a+float64(score))/b))
+	return win, 1 - win - loss, loss
+}
+
+// scoreWdl converts a search score for the side to move in game. A forced
+// mate is certain.
+func scoreWdl(game *Game, score int) wdl {
+	if score > mateBound {
+		return wdl{Win: 1000}
+	}
+	if score < -mateBound {
+		return wdl{Loss: 1000}
+	}
+
+	win, _, loss := wdlParams.probabilities(score, traceEvaluation(game).Phase)
+	var result wdl = wdl{Win: int(math.Round(win * 1000)), Loss: int(math.Round(loss * 1000))}
+	result.Draw = 1000 - result.Win - result.Loss
+	if result.Draw < 0 { //both rounded up
+		result.Loss += result.Draw
+		result.Draw = 0
+	}
+	return result
+}
+
+// parseWdl reads a model as written by the wdlfit command.
+func parseWdl(data []byte) (wdlModel, error) {
+	var m wdlModel = defaultWdl
+	if err := json.Unmarshal(data, &m); err != nil {
+		return wdlModel{}, fmt.Errorf("invalid win/draw/loss model: %w", err)
+	}
+	return m, nil
+}
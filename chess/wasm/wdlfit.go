@@ -0,0 +1,176 @@
+//go:build !js
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Fitting the win/draw/loss model: the engine plays itself from randomized
+// openings, every searched position is labeled with the final result for
+// its side to move, and the coefficients are walked one at a time to the
+// smallest log loss of the predicted probabilities.
+
+const (
+	wdlMaxPlies = 400  //plies after which a self-play game counts as drawn
+	wdlMinStep  = 0.01 //the fit stops when no step of this size helps
+)
+
+type wdlSample struct {
+	score  int
+	phase  int
+	result float64 //1 the side to move won, 0.5 draw, 0 lost
+}
+
+func wdlfitCommand(args []string) error {
+	var flags *flag.FlagSet = flag.NewFlagSet("wdlfit", flag.ExitOnError)
+	var games *int = flags.Int("games", 200, "self-play games")
+	var nodes *int = flags.Int("nodes", 5000, "nodes searched per move")
+	var random *int = flags.Int("random", 8, "random plies at the start of every game")
+	var out *string = flags.String("out", "wdl.json", "output file")
+	var passes *int = flags.Int("passes", 100, "maximum number of passes over the coefficients per step size")
+	flags.Parse(args)
+
+	var samples []wdlSample
+	var results [3]int //wins, draws and losses of white
+	for i := 1; i <= *games; i++ {
+		tmp, result := selfPlayGame(*nodes, *random)
+		samples = append(samples, tmp...)
+		results[int(2-2*result)]++
+		fmt.Fprintf(os.Stderr, "game: %d result: +%d =%d -%d positions: %d\n", i, results[0], results[1], results[2], len(samples))
+	}
+
+	if len(samples) == 0 {
+		return errors.New("wdlfit: no positions")
+	}
+
+	var m wdlModel = wdlParams
+	var bestError float64 = wdlError(&m, samples)
+	fmt.Fprintf(os.Stderr, "initial error: %.6f\n", bestError)
+
+	var values []*float64
+	for i := range m.A {
+		values = append(values, &m.A[i], &m.B[i])
+	}
+
+	for step := 16.0; step >= wdlMinStep; step /= 2 {
+		for pass, improved := 0, true; improved && pass < *passes; pass++ {
+			improved = false
+			for _, value := range values {
+				for _, delta := range []float64{step, -step} {
+					*value += delta
+					if e := wdlError(&m, samples); e < bestError {
+						bestError = e
+						improved = true
+						break
+					}
+					*value -= delta
+				}
+			}
+		}
+		fmt.Fprintf(os.Stderr, "step: %.2f error: %.6f\n", step, bestError)
+	}
+
+	data, err := json.MarshalIndent(roundWdl(m), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, append(data, '\n'), 0644)
+}
+
+// selfPlayGame plays a game from the start position at a fixed number of
+// nodes per move, after random plies so that the games differ. It returns
+// the positions searched and the result for white. A forced mate found by
+// the search ends the game.
+func selfPlayGame(nodes int, random int) ([]wdlSample, float64) {
+	var fen string = initialFen
+	start, _ := loadFen(&fen)
+	var g *GameSession = newGameSession(start)
+	var table *transpositionTable = newTranspositionTable(defaultHashSize)
+
+	var samples []wdlSample
+	var colors []PieceColor
+	var winner PieceColor
+	var decided bool = false
+
+	for ply := 0; ply < wdlMaxPlies; ply++ {
+		var game *Game = g.current()
+		if status := g.status(); status != "ongoing" && status != "check" {
+			if status == "checkmate" {
+				winner, decided = flipColor(game.color), true
+			}
+			break
+		}
+
+		if ply < random {
+			g.play(randomMove(game))
+			continue
+		}
+
+		var s search = search{nodeLimit: nodes, table: table, history: g.history()}
+		var line searchLine = s.iterate(game, maxSearchDepth, 1, nil)[0]
+		if line.Score > mateBound {
+			winner, decided = game.color, true
+			break
+		}
+		if line.Score < -mateBound {
+			winner, decided = flipColor(game.color), true
+			break
+		}
+
+		samples = append(samples, wdlSample{score: line.Score, phase: traceEvaluation(game).Phase})
+		colors = append(colors, game.color)
+		g.play(line.move)
+	}
+
+	var result float64 = 0.5
+	if decided {
+		result = float64(winner) //White is 1
+	}
+	for i := range samples {
+		samples[i].result = result
+		if colors[i] == Black {
+			samples[i].result = 1 - result
+		}
+	}
+	return samples, result
+}
+
+// wdlError is the mean log loss of the probabilities the model gives the
+// results of the samples.
+func wdlError(m *wdlModel, samples []wdlSample) float64 {
+	var sum float64 = 0
+	for _, sample := range samples {
+		win, draw, loss := m.probabilities(sample.score, sample.phase)
+		var p float64 = draw
+		if sample.result == 1 {
+			p = win
+		} else if sample.result == 0 {
+			p = loss
+		}
+		sum -= math.Log(max(p, 1e-9))
+	}
+	return sum / float64(len(samples))
+}
+
+// roundWdl keeps two decimals of the coefficients, more would only be noise.
+func roundWdl(m wdlModel) wdlModel {
+	for i := range m.A {
+		m.A[i] = math.Round(m.A[i]*100) / 100
+		m.B[i] = math.Round(m.B[i]*100) / 100
+	}
+	return m
+}
+
+func loadWdlFile(path string) (wdlModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return wdlModel{}, err
+	}
+	return parseWdl(data)
+}